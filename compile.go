@@ -0,0 +1,588 @@
+package jstn
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// A Validator checks JSON documents against a JSTN type that has been
+// compiled in advance, which makes it faster than Validate for types that
+// are used repeatedly. A Validator is safe for concurrent use by multiple
+// goroutines.
+type Validator struct {
+	root *node
+	opts ValidatorOptions
+}
+
+// Compile prepares t for efficient repeated validation.
+func Compile(t Type) (*Validator, error) {
+	return ValidatorOptions{}.Compile(t)
+}
+
+// Compile prepares t for efficient repeated validation according to the
+// options in o.
+func (o ValidatorOptions) Compile(t Type) (*Validator, error) {
+	root, err := compile(t)
+	if err != nil {
+		return nil, err
+	}
+	return &Validator{root: root, opts: o}, nil
+}
+
+// MustCompile is equivalent to Compile, except that it panics if the type
+// cannot be compiled.
+func MustCompile(t Type) *Validator {
+	v, err := Compile(t)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Valid indicates whether the JSON document in is considered valid with
+// respect to the compiled type.
+func (v *Validator) Valid(in []byte) bool {
+	return v.Validate(in) == nil
+}
+
+// Validate is like the Validate function, but checks in against the
+// compiled type.
+func (v *Validator) Validate(in []byte) error {
+	val := newBytesValidator(in, v.opts)
+	defer val.release()
+	return val.validate(v.root)
+}
+
+// ValidateReader is like the ValidateReader function, but checks the
+// document read from r against the compiled type.
+func (v *Validator) ValidateReader(r io.Reader) error {
+	val := newValidator(r, v.opts)
+	defer val.release()
+	return val.validate(v.root)
+}
+
+// A node is the compiled form of a Type. Nodes are also made one at a time
+// as an uncompiled type is walked, in which case only the fields describing
+// the type itself are set, and src is the type, from which the nodes of its
+// children are made as they're reached.
+type node struct {
+	kind Kind
+	modifiers
+	src *Type
+
+	// For arrays, the type of the elements, or nil if the array must be
+	// empty.
+	items *node
+
+	// For objects, the declared properties sorted by name and the number of
+	// them that may not be omitted. Large objects also get an index into props
+	// by name; smaller ones are binary searched. Open objects permit
+	// undeclared properties.
+	props    []prop
+	index    map[string]int
+	required int
+	open     bool
+
+	// For unions, the alternative types.
+	alts []*node
+
+	// For tuples, the element types and the number of them that are
+	// required, which excludes any trailing omittable elements.
+	elems    []*node
+	minElems int
+
+	// For maps, the type of every value and the pattern keys must match.
+	values  *node
+	pattern *regexp.Regexp
+
+	// For literals, the encoded value and its decoding, which is either a
+	// string or a decimal.
+	literal json.RawMessage
+	value   interface{}
+
+	// The constraints on values, if any, and for strings the format and
+	// its name.
+	limits     *limits
+	format     FormatFunc
+	formatName string
+}
+
+// limits are the compiled form of Constraints.
+type limits struct {
+	Constraints
+	min, max decimal        // the decoded Min and Max
+	pattern  *regexp.Regexp // the compiled Pattern
+}
+
+// modifiers records whether a value may be absent and whether it may be null.
+type modifiers struct {
+	omittable bool
+	nullable  bool
+}
+
+// modifiersOf returns the modifiers of t, for which being optional means
+// being both omittable and nullable.
+func modifiersOf(t Type) modifiers {
+	return modifiers{
+		omittable: t.Optional || t.Omittable,
+		nullable:  t.Optional || t.Nullable,
+	}
+}
+
+// or returns the modifiers that m and o permit between them.
+func (m modifiers) or(o modifiers) modifiers {
+	return modifiers{omittable: m.omittable || o.omittable, nullable: m.nullable || o.nullable}
+}
+
+type prop struct {
+	name string
+	node *node
+}
+
+// indexThreshold is the number of properties above which an object node is
+// given a map index rather than being binary searched.
+const indexThreshold = 16
+
+// lookup returns the index into n.props of the property with the given name.
+func (n *node) lookup(name string) (int, bool) {
+
+	if n.index != nil {
+		i, ok := n.index[name]
+		return i, ok
+	}
+
+	lo, hi := 0, len(n.props)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if n.props[mid].name < name {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, lo < len(n.props) && n.props[lo].name == name
+
+}
+
+// A compiler converts Types into nodes. Rather than allocating each node and
+// property list separately, it carves them out of larger chunks.
+//
+// Each named type is compiled only once, however often it is referred to,
+// which also allows named types to refer to themselves. A reference that
+// permits more than its named type, such as an optional reference to a named
+// type that isn't optional, needs a copy of its node with other modifiers,
+// which can only be made once the named type has been compiled in full, so
+// those copies are completed last.
+type compiler struct {
+	nodes []node
+	props []prop
+
+	named    map[*Type]*node   // the compiled named types
+	variants map[variant]*node // copies of compiled named types
+	copies   []variant         // the variants copied, in order
+}
+
+// A variant is a named type with modifiers other than its own.
+type variant struct {
+	target *Type
+	modifiers
+}
+
+// chunkSize is the number of nodes or properties allocated at once.
+const chunkSize = 8
+
+// compile converts t into its compiled form.
+func compile(t Type) (*node, error) {
+
+	c := &compiler{}
+	root, err := c.compile(t)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range c.copies {
+		n := c.variants[key]
+		*n = *c.named[key.target]
+		n.modifiers = key.modifiers
+	}
+
+	return root, nil
+
+}
+
+// newNode returns a pointer to a new node.
+func (c *compiler) newNode(n node) *node {
+	if len(c.nodes) == cap(c.nodes) {
+		c.nodes = make([]node, 0, chunkSize)
+	}
+	c.nodes = append(c.nodes, n)
+	return &c.nodes[len(c.nodes)-1]
+}
+
+// newProps returns a new slice of n properties.
+func (c *compiler) newProps(n int) []prop {
+	if cap(c.props)-len(c.props) < n {
+		size := chunkSize
+		if n > size {
+			size = n
+		}
+		c.props = make([]prop, 0, size)
+	}
+	start := len(c.props)
+	c.props = c.props[:start+n]
+	return c.props[start : start+n : start+n]
+}
+
+func (c *compiler) compile(t Type) (*node, error) {
+
+	n := c.newNode(node{})
+	if err := n.init(&t, false); err != nil {
+		return nil, err
+	}
+
+	switch t.Kind {
+	case Array:
+		if t.Items != nil {
+			items, err := c.compile(*t.Items)
+			if err != nil {
+				return nil, err
+			}
+			n.items = items
+		}
+
+	case Object:
+		n.props = c.newProps(len(t.Properties))
+		i := 0
+		for name := range t.Properties {
+			n.props[i].name = name
+			i++
+		}
+		sortProps(n.props)
+
+		for i := range n.props {
+			pn, err := c.compile(*t.Properties[n.props[i].name])
+			if err != nil {
+				return nil, err
+			}
+			n.props[i].node = pn
+		}
+
+		if len(n.props) > indexThreshold {
+			n.index = make(map[string]int, len(n.props))
+			for i, p := range n.props {
+				n.index[p.name] = i
+			}
+		}
+
+	case Tuple:
+		n.elems = make([]*node, len(t.Elements))
+		for i, et := range t.Elements {
+			en, err := c.compile(*et)
+			if err != nil {
+				return nil, err
+			}
+			n.elems[i] = en
+		}
+
+	case Map:
+		values, err := c.compile(*t.Values)
+		if err != nil {
+			return nil, err
+		}
+		n.values = values
+
+	case Reference:
+		return c.compileReference(t)
+
+	case Union:
+		n.alts = make([]*node, len(t.Alternatives))
+		for i, at := range t.Alternatives {
+			an, err := c.compile(*at)
+			if err != nil {
+				return nil, err
+			}
+			n.alts[i] = an
+		}
+	}
+
+	return n, nil
+
+}
+
+// init sets the fields of n that describe t itself, as opposed to the types
+// it contains, after checking that t is valid. An unknown format is an error
+// unless anyFormat is set, in which case the format is ignored.
+func (n *node) init(t *Type, anyFormat bool) error {
+
+	*n = node{kind: t.Kind, modifiers: modifiersOf(*t)}
+
+	if t.Constraints != nil {
+		l, err := compileConstraints(t.Kind, t.Constraints)
+		if err != nil {
+			return err
+		}
+		n.limits = l
+	}
+
+	if t.Format != "" {
+		if t.Kind != String {
+			return fmt.Errorf("jstn: format %s does not apply to %s", t.Format, t.Kind)
+		}
+		if f, ok := lookupFormat(t.Format); ok {
+			n.format, n.formatName = f, t.Format
+		} else if !anyFormat {
+			return fmt.Errorf("jstn: unknown format %s", t.Format)
+		}
+	}
+
+	switch t.Kind {
+	case String, Number, Integer, Boolean, Null, Any, Array, Reference:
+		// nothing more to do
+
+	case Object:
+		n.open = t.Open
+		for name, pt := range t.Properties {
+			if pt == nil {
+				return fmt.Errorf("jstn: property %q has a nil type", name)
+			}
+			mods, err := modifiersFollowing(pt)
+			if err != nil {
+				return err
+			}
+			if !mods.omittable {
+				n.required++
+			}
+		}
+
+	case Tuple:
+		for i, et := range t.Elements {
+			if et == nil {
+				return fmt.Errorf("jstn: tuple element %d has a nil type", i)
+			}
+			mods, err := modifiersFollowing(et)
+			if err != nil {
+				return err
+			}
+			if !mods.omittable {
+				n.minElems = i + 1
+			}
+		}
+
+	case Map:
+		if t.Values == nil {
+			return fmt.Errorf("jstn: map has a nil value type")
+		}
+		if t.KeyPattern != "" {
+			var err error
+			if n.pattern, err = compilePattern(t.KeyPattern); err != nil {
+				return fmt.Errorf("jstn: invalid key pattern %q: %s", t.KeyPattern, err)
+			}
+		}
+
+	case Literal:
+		var s string
+		value := bytes.TrimSpace(t.Value)
+		if d, ok := parseDecimal(json.Number(value)); ok {
+			n.value = d
+		} else if len(value) > 0 && value[0] == '"' && json.Unmarshal(value, &s) == nil {
+			n.value = s
+		} else {
+			return fmt.Errorf("jstn: literal %q is not a JSON string or number", t.Value)
+		}
+		n.literal = value
+
+	case Union:
+		if len(t.Alternatives) == 0 {
+			return fmt.Errorf("jstn: union has no alternatives")
+		}
+		for i, at := range t.Alternatives {
+			if at == nil {
+				return fmt.Errorf("jstn: union alternative %d has a nil type", i)
+			}
+		}
+
+	default:
+		return fmt.Errorf("jstn: unknown kind %s", t.Kind)
+	}
+
+	return nil
+
+}
+
+// compileConstraints checks that the constraints c apply to kind k, and
+// prepares them for use.
+func compileConstraints(k Kind, c *Constraints) (*limits, error) {
+
+	for _, name := range c.names() {
+		if !constraintApplies(name, k) {
+			return nil, fmt.Errorf("jstn: constraint %s does not apply to %s", name, k)
+		}
+	}
+
+	for name, n := range map[string]*int{"minLength": c.MinLength, "maxLength": c.MaxLength, "minItems": c.MinItems, "maxItems": c.MaxItems} {
+		if n != nil && *n < 0 {
+			return nil, fmt.Errorf("jstn: constraint %s must not be negative", name)
+		}
+	}
+
+	l := &limits{Constraints: *c}
+	var ok bool
+	if c.Min != "" {
+		if l.min, ok = parseDecimal(c.Min); !ok {
+			return nil, fmt.Errorf("jstn: constraint min %q is not a JSON number", c.Min)
+		}
+	}
+	if c.Max != "" {
+		if l.max, ok = parseDecimal(c.Max); !ok {
+			return nil, fmt.Errorf("jstn: constraint max %q is not a JSON number", c.Max)
+		}
+	}
+	if c.Pattern != "" {
+		var err error
+		if l.pattern, err = compilePattern(c.Pattern); err != nil {
+			return nil, fmt.Errorf("jstn: invalid pattern %q: %s", c.Pattern, err)
+		}
+	}
+
+	return l, nil
+
+}
+
+// compileReference compiles a reference to a named type, which is compiled
+// in turn unless it already has been.
+func (c *compiler) compileReference(t Type) (*node, error) {
+
+	target, mods, err := followReference(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.named == nil {
+		c.named = make(map[*Type]*node)
+		c.variants = make(map[variant]*node)
+	}
+
+	// note the node for the named type before compiling it, so that any
+	// references it contains to itself find it
+	n, ok := c.named[target]
+	if !ok {
+		n = c.newNode(node{kind: target.Kind, modifiers: modifiersOf(*target)})
+		c.named[target] = n
+
+		compiled, err := c.compile(*target)
+		if err != nil {
+			return nil, err
+		}
+		*n = *compiled
+	}
+
+	mods = n.modifiers.or(mods)
+	if mods == n.modifiers {
+		return n, nil
+	}
+
+	key := variant{target: target, modifiers: mods}
+	copied, ok := c.variants[key]
+	if !ok {
+		copied = c.newNode(node{kind: target.Kind, modifiers: mods})
+		c.variants[key] = copied
+		c.copies = append(c.copies, key)
+	}
+	return copied, nil
+
+}
+
+// followReference follows the reference t, and any references it leads to
+// in turn, to a named type that isn't itself a reference. It also reports
+// the modifiers of the references followed between them.
+func followReference(t Type) (*Type, modifiers, error) {
+
+	var mods modifiers
+
+	// a second pointer follows the references at half speed, and meets the
+	// first only if the references go round in a cycle
+	ref, slow := &t, &t
+	for i := 0; ref.Kind == Reference; i++ {
+		if ref.Target == nil {
+			return nil, mods, fmt.Errorf("jstn: reference to undefined type %s", ref.Name)
+		}
+		mods = mods.or(modifiersOf(*ref))
+		if ref = ref.Target; ref == slow {
+			return nil, mods, fmt.Errorf("jstn: type %s is defined only in terms of itself", t.Name)
+		}
+		if i%2 == 1 {
+			slow = slow.Target
+		}
+	}
+
+	return ref, mods, nil
+
+}
+
+// modifiersFollowing returns the modifiers of t, which for a reference are
+// those of the named type it refers to combined with its own.
+func modifiersFollowing(t *Type) (modifiers, error) {
+	if t.Kind != Reference {
+		return modifiersOf(*t), nil
+	}
+	target, mods, err := followReference(*t)
+	if err != nil {
+		return modifiers{}, err
+	}
+	return modifiersOf(*target).or(mods), nil
+}
+
+// patterns caches compiled regular expressions by source, so that walking an
+// uncompiled type doesn't compile them again for every value. The cache is
+// limited to maxPatterns entries, beyond which patterns are compiled anew.
+var patterns = struct {
+	sync.RWMutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+const maxPatterns = 256
+
+// compilePattern returns the compiled form of the regular expression expr.
+func compilePattern(expr string) (*regexp.Regexp, error) {
+
+	patterns.RLock()
+	re, ok := patterns.m[expr]
+	patterns.RUnlock()
+	if ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns.Lock()
+	if len(patterns.m) < maxPatterns {
+		patterns.m[expr] = re
+	}
+	patterns.Unlock()
+
+	return re, nil
+
+}
+
+// sortProps sorts props by name. Most objects are small, so an insertion
+// sort serves them without allocating.
+func sortProps(props []prop) {
+	if len(props) > indexThreshold {
+		sort.Slice(props, func(i, j int) bool { return props[i].name < props[j].name })
+		return
+	}
+	for i := 1; i < len(props); i++ {
+		for j := i; j > 0 && props[j].name < props[j-1].name; j-- {
+			props[j], props[j-1] = props[j-1], props[j]
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package jstn
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+
+	v, err := Compile(WrittenCollectionType)
+	if err != nil {
+		t.Fatalf("unexpected compile error: %s", err)
+	}
+
+	cases := []struct {
+		TestData string
+		Error    error
+	}{
+		{
+			TestData: `{"author":{},"works":[{"title":"Faust","language":"de"}]}`,
+		},
+		{
+			TestData: `{"author":{"penName":null},"works":[{"title":"Faust","language":"de","pageCount":500}]}`,
+		},
+		{
+			TestData: `{"author":{},"works":[{"language":"de"}]}`,
+			Error:    &ValidationError{Path: "/works/0/title", Reason: MissingProperty, Expected: String, Offset: 39},
+		},
+	}
+
+	// a Validator may be shared between goroutines
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, c := range cases {
+				if err := v.Validate([]byte(c.TestData)); !reflect.DeepEqual(err, c.Error) {
+					t.Errorf("[case %d] unexpected validation error: expected %v but got %v", i, c.Error, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+}
+
+func TestCompile_ManyProperties(t *testing.T) {
+
+	// objects with more than 64 properties don't fit in a single word of the
+	// seen-properties bitset
+	var schema, doc []string
+	for i := 0; i < 100; i++ {
+		schema = append(schema, fmt.Sprintf("p%d: number", i))
+		if i != 70 {
+			doc = append(doc, fmt.Sprintf(`"p%d": %d`, i, i))
+		}
+	}
+
+	v := MustCompile(MustParse("{" + strings.Join(schema, ";") + "}"))
+
+	err := v.Validate([]byte("{" + strings.Join(doc, ",") + "}"))
+	if verr, ok := err.(*ValidationError); !ok || verr.Path != "/p70" || verr.Reason != MissingProperty {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+
+}
+
+func TestCompile_Recursive(t *testing.T) {
+
+	// a type defined only in terms of itself can't be compiled
+	a := &Type{Kind: Reference, Name: "B"}
+	b := &Type{Kind: Reference, Name: "A", Target: a}
+	a.Target = b
+	if _, err := Compile(*a); err == nil {
+		t.Errorf("expected compile error")
+	}
+	if err := Validate(*a, []byte(`1`)); err == nil {
+		t.Errorf("expected error validating against the type")
+	} else if _, ok := err.(*ValidationError); ok {
+		t.Errorf("unexpected validation error: %s", err)
+	}
+
+	// but one that refers to itself within a structure can, and is compiled
+	// just once
+	list := &Type{Kind: Object, Properties: map[string]*Type{
+		"value": &Type{Kind: Number},
+	}}
+	list.Properties["next"] = &Type{Kind: Reference, Name: "List", Optional: true, Target: list}
+
+	v, err := Compile(Type{Kind: Reference, Name: "List", Target: list})
+	if err != nil {
+		t.Fatalf("unexpected compile error: %s", err)
+	}
+
+	i, _ := v.root.lookup("next")
+	if next := v.root.props[i].node; !next.omittable || len(next.props) != 2 || next.props[i].node != next {
+		t.Errorf("unexpected compilation of next: %+v", next)
+	}
+
+}
+
+func TestCompile_Invalid(t *testing.T) {
+
+	cases := []Type{
+		{Kind: Kind(99)},
+		{Kind: Array, Items: &Type{Kind: Kind(99)}},
+		{Kind: Object, Properties: map[string]*Type{"key": nil}},
+		{Kind: Union},
+		{Kind: Union, Alternatives: []*Type{{Kind: String}, nil}},
+		{Kind: Union, Alternatives: []*Type{{Kind: String}, {Kind: Array, Items: &Type{Kind: Kind(99)}}}},
+		{Kind: Tuple, Elements: []*Type{{Kind: String}, nil}},
+		{Kind: Map},
+		{Kind: Map, Values: &Type{Kind: String}, KeyPattern: "("},
+		{Kind: Reference, Name: "Undefined"},
+		{Kind: Reference, Name: "Invalid", Target: &Type{Kind: Kind(99)}},
+		{Kind: Literal},
+		{Kind: Literal, Value: json.RawMessage(`true`)},
+		{Kind: Literal, Value: json.RawMessage(`"unterminated`)},
+		{Kind: String, Constraints: &Constraints{Min: "1"}},
+		{Kind: Reference, Name: "Constrained", Target: &Type{Kind: Number}, Constraints: &Constraints{Max: "1"}},
+		{Kind: Number, Constraints: &Constraints{Min: "one"}},
+		{Kind: String, Constraints: &Constraints{Pattern: "("}},
+		{Kind: Array, Items: &Type{Kind: String}, Constraints: &Constraints{MinItems: new(int), MaxItems: intPtr(-1)}},
+		{Kind: String, Format: "no-such-format"},
+		{Kind: Number, Format: "uuid"},
+	}
+
+	for i, c := range cases {
+		if _, err := Compile(c); err == nil {
+			t.Errorf("[case %d] expected compile error", i)
+		}
+
+		// validating against the type without compiling it fails in the
+		// same way once the walk reaches the invalid part
+		err := Validate(c, []byte(`[1]`))
+		if _, ok := err.(*ValidationError); err == nil || ok {
+			t.Errorf("[case %d] expected error validating against the type, but got %v", i, err)
+		}
+	}
+
+}
+
+func BenchmarkValidator(b *testing.B) {
+
+	// a record with more properties than a small object
+	record := `{"id":"a1","name":"some name","email":"a@example.com","phone":"555","street":"1 Road","city":"Town","region":"North","postcode":"12345","country":"XX","created":"2006-01-02","updated":"2006-01-03","status":"active"}`
+
+	cases := []struct {
+		Name   string
+		Schema string
+		Doc    string
+	}{
+		{
+			Name: "Small",
+			Schema: `{
+	renderingOptions: {
+		orientation: string?
+	}
+	inputs: [{
+		inputId: string
+		type: string
+		value: number?
+	}]
+}`,
+			Doc: `{
+		"renderingOptions": {},
+		"inputs": [
+			{
+				"inputId": "some string",
+				"type": "some type"
+			}
+		]
+	}`,
+		},
+		{
+			Name: "Wide",
+			Schema: `{records: [{
+	id: string; name: string; email: string; phone: string
+	street: string; city: string; region: string; postcode: string; country: string
+	created: string; updated: string; status: string; note?: string
+}]}`,
+			Doc: `{"records":[` + strings.Repeat(record+",", 9) + record + `]}`,
+		},
+	}
+
+	// each document is validated against its type both uncompiled and
+	// compiled. Compiling saves time, but few allocations, since most are
+	// made by the json.Decoder in boxing each token, whichever is used.
+	for _, c := range cases {
+
+		schema := MustParse(c.Schema)
+		doc := []byte(c.Doc)
+
+		b.Run(c.Name+"/Valid", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = Valid(schema, doc)
+			}
+		})
+
+		v := MustCompile(schema)
+		b.Run(c.Name+"/Validator.Valid", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = v.Valid(doc)
+			}
+		})
+
+	}
+
+}
@@ -0,0 +1,183 @@
+package jstn
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ApplyDefaults returns a copy of the JSON document doc in which each object
+// property that is absent, and whose type in t has a default value, is set to
+// that value, itself with defaults applied. Properties are added after those
+// already present, and the result is compact. Defaults are applied within
+// values of a union type using the first alternative that the value
+// satisfies, and not at all within values whose type differs from that
+// declared; ApplyDefaults doesn't otherwise validate doc, which may be
+// validated against t afterwards. It returns an error only if doc isn't
+// well-formed JSON.
+func ApplyDefaults(t Type, doc []byte) ([]byte, error) {
+
+	var raw json.RawMessage
+	if err := json.Unmarshal(doc, &raw); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := applyDefaults(&buf, &t, raw); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := json.Compact(&out, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+
+}
+
+// applyDefaults writes the JSON value raw to buf, applying the defaults of
+// the properties of t within it.
+func applyDefaults(buf *bytes.Buffer, t *Type, raw json.RawMessage) error {
+
+	// follow references to the named types they refer to
+	if t != nil && t.Kind == Reference {
+		target, _, err := followReference(*t)
+		if err != nil {
+			buf.Write(raw)
+			return nil
+		}
+		t = target
+	}
+
+	if t == nil || len(raw) == 0 {
+		buf.Write(raw)
+		return nil
+	}
+
+	switch {
+	case t.Kind == Object && raw[0] == '{':
+		return applyObject(buf, t, raw)
+
+	case t.Kind == Map && raw[0] == '{':
+		return applyMembers(buf, raw, func(string) *Type { return t.Values })
+
+	case t.Kind == Array && raw[0] == '[':
+		return applyElements(buf, raw, func(int) *Type { return t.Items })
+
+	case t.Kind == Tuple && raw[0] == '[':
+		return applyElements(buf, raw, func(i int) *Type {
+			if i < len(t.Elements) {
+				return t.Elements[i]
+			}
+			return nil
+		})
+
+	case t.Kind == Union:
+		for _, alt := range t.Alternatives {
+			if alt != nil && Valid(*alt, raw) {
+				return applyDefaults(buf, alt, raw)
+			}
+		}
+	}
+
+	buf.Write(raw)
+	return nil
+
+}
+
+// applyObject writes the JSON object raw to buf, applying the defaults of the
+// object type t.
+func applyObject(buf *bytes.Buffer, t *Type, raw json.RawMessage) error {
+
+	present := make(map[string]bool)
+	err := applyMembers(buf, raw, func(name string) *Type {
+		present[name] = true
+		return t.Properties[name]
+	})
+	if err != nil {
+		return err
+	}
+
+	// add the absent properties with defaults before the closing brace
+	buf.Truncate(buf.Len() - 1)
+	for _, name := range t.PropertyNames() {
+		pt := t.Properties[name]
+		if present[name] || pt == nil || pt.Default == nil {
+			continue
+		}
+		if len(present) > 0 {
+			buf.WriteByte(',')
+		}
+		present[name] = true
+		buf.WriteString(quote(name))
+		buf.WriteByte(':')
+		if err := applyDefaults(buf, pt, pt.Default); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+
+	return nil
+
+}
+
+// applyMembers writes the JSON object raw to buf, applying the defaults of
+// the type that typeOf gives for each member.
+func applyMembers(buf *bytes.Buffer, raw json.RawMessage, typeOf func(name string) *Type) error {
+
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if _, err := d.Token(); err != nil {
+		return err
+	}
+
+	buf.WriteByte('{')
+	for i := 0; d.More(); i++ {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		name := tok.(string)
+
+		var value json.RawMessage
+		if err := d.Decode(&value); err != nil {
+			return err
+		}
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(quote(name))
+		buf.WriteByte(':')
+		if err := applyDefaults(buf, typeOf(name), value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+
+	return nil
+
+}
+
+// applyElements writes the JSON array raw to buf, applying the defaults of
+// the type that typeOf gives for each element.
+func applyElements(buf *bytes.Buffer, raw json.RawMessage, typeOf func(i int) *Type) error {
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return err
+	}
+
+	buf.WriteByte('[')
+	for i, elem := range elems {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := applyDefaults(buf, typeOf(i), elem); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte(']')
+
+	return nil
+
+}
@@ -0,0 +1,99 @@
+package jstn
+
+import (
+	"testing"
+)
+
+func TestApplyDefaults(t *testing.T) {
+
+	schema := MustParse(`type Limits = {
+	max: integer? = 10
+	burst?: integer = 2
+}
+
+{
+	name: string
+	retries?: number = 3
+	mode: string? = "fast"
+	tags?: [string] = ["a", "b"]
+	limits?: Limits = {}
+	rules?: [Limits]
+	byHost?: {[string]: Limits}
+	pair?: [Limits, string]
+	either?: {kind: string; size?: integer = 1} | [Limits]
+}`)
+
+	cases := []struct {
+		TestData string
+		Applied  string
+	}{
+		// absent properties are added in order of declaration, with the
+		// defaults of their own properties
+		{
+			TestData: `{"name":"x"}`,
+			Applied:  `{"name":"x","retries":3,"mode":"fast","tags":["a","b"],"limits":{"max":10,"burst":2}}`,
+		},
+		{
+			TestData: `{}`,
+			Applied:  `{"retries":3,"mode":"fast","tags":["a","b"],"limits":{"max":10,"burst":2}}`,
+		},
+
+		// present properties are untouched, even if null
+		{
+			TestData: `{"mode": null, "name": "x", "retries": 5, "tags": [], "limits": {"max": 1}}`,
+			Applied:  `{"mode":null,"name":"x","retries":5,"tags":[],"limits":{"max":1,"burst":2}}`,
+		},
+
+		// defaults apply within arrays, maps, tuples and references
+		{
+			TestData: `{"rules":[{},{"burst":0}],"byHost":{"a":{"max":1}},"pair":[{},"b"],"retries":1,"mode":"","tags":null,"limits":null}`,
+			Applied:  `{"rules":[{"max":10,"burst":2},{"burst":0,"max":10}],"byHost":{"a":{"max":1,"burst":2}},"pair":[{"max":10,"burst":2},"b"],"retries":1,"mode":"","tags":null,"limits":null}`,
+		},
+
+		// and within the alternative of a union that a value satisfies
+		{
+			TestData: `{"either":{"kind":"k"},"retries":1,"mode":"","tags":[],"limits":{}}`,
+			Applied:  `{"either":{"kind":"k","size":1},"retries":1,"mode":"","tags":[],"limits":{"max":10,"burst":2}}`,
+		},
+		{
+			TestData: `{"either":[{}],"retries":1,"mode":"","tags":[],"limits":{}}`,
+			Applied:  `{"either":[{"max":10,"burst":2}],"retries":1,"mode":"","tags":[],"limits":{"max":10,"burst":2}}`,
+		},
+
+		// but not within values of the wrong type
+		{
+			TestData: `[{}]`,
+			Applied:  `[{}]`,
+		},
+		{
+			TestData: `{"rules":{"a":{}},"retries":1,"mode":"","tags":[],"limits":"none"}`,
+			Applied:  `{"rules":{"a":{}},"retries":1,"mode":"","tags":[],"limits":"none"}`,
+		},
+	}
+
+	for i, c := range cases {
+
+		out, err := ApplyDefaults(schema, []byte(c.TestData))
+		if err != nil {
+			t.Errorf("[case %d] unexpected error: %s", i, err)
+			continue
+		}
+
+		if string(out) != c.Applied {
+			t.Errorf("[case %d] unexpected result: expected\n%s\nbut got\n%s", i, c.Applied, out)
+		}
+
+	}
+
+	// a document with its defaults applied satisfies the schema
+	out, err := ApplyDefaults(schema, []byte(`{"name":"x"}`))
+	if err != nil || !Valid(schema, out) {
+		t.Errorf("unexpected result %s: %v", out, err)
+	}
+
+	// malformed documents are an error
+	if _, err := ApplyDefaults(schema, []byte(`{"name":}`)); err == nil {
+		t.Errorf("expected an error applying defaults to malformed JSON")
+	}
+
+}
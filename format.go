@@ -0,0 +1,115 @@
+package jstn
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A FormatFunc reports whether the string s has a particular format.
+type FormatFunc func(s string) bool
+
+var formats = struct {
+	sync.RWMutex
+	m map[string]FormatFunc
+}{m: map[string]FormatFunc{
+	"date-time": isDateTime,
+	"date":      isDate,
+	"time":      isTime,
+	"uuid":      regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString,
+	"email":     isEmail,
+	"uri":       isURI,
+	"ipv4":      isIPv4,
+	"ipv6":      isIPv6,
+}}
+
+// RegisterFormat makes the string format f available to JSTN types by name,
+// as in string<name>, replacing any format already registered by that name.
+// A name consists of letters, digits, hyphens and underscores, beginning with
+// a letter. RegisterFormat panics if the name is invalid or f is nil.
+//
+// Types are bound to the formats registered when they are compiled, so
+// formats are best registered during initialization.
+func RegisterFormat(name string, f FormatFunc) {
+
+	if !isFormatName(name) {
+		panic(fmt.Sprintf("jstn: invalid format name %q", name))
+	}
+	if f == nil {
+		panic("jstn: nil FormatFunc for format " + name)
+	}
+
+	formats.Lock()
+	formats.m[name] = f
+	formats.Unlock()
+
+}
+
+// lookupFormat returns the format registered by name, if any.
+func lookupFormat(name string) (FormatFunc, bool) {
+	formats.RLock()
+	f, ok := formats.m[name]
+	formats.RUnlock()
+	return f, ok
+}
+
+// isFormatName reports whether s is a valid format name.
+func isFormatName(s string) bool {
+	for i, ch := range s {
+		if !isLetter(ch) && (i == 0 || !isFormatRune(ch)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isFormatRune(ch rune) bool {
+	return isLetter(ch) || isDigit(ch) || ch == '-' || ch == '_'
+}
+
+// isDateTime reports whether s is an RFC 3339 date-time, such as
+// 2006-01-02T15:04:05Z.
+func isDateTime(s string) bool {
+	_, err := time.Parse(time.RFC3339Nano, strings.ToUpper(s))
+	return err == nil
+}
+
+// isDate reports whether s is an RFC 3339 full-date, such as 2006-01-02.
+func isDate(s string) bool {
+	_, err := time.Parse("2006-01-02", s)
+	return err == nil
+}
+
+// isTime reports whether s is an RFC 3339 full-time, such as 15:04:05Z.
+func isTime(s string) bool {
+	return isDateTime("2006-01-02T" + s)
+}
+
+// isEmail reports whether s is an RFC 5322 address without a display name,
+// such as user@example.com.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Name == "" && addr.Address == s
+}
+
+// isURI reports whether s is an absolute URI, which has a scheme.
+func isURI(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.IsAbs()
+}
+
+// isIPv4 reports whether s is an IPv4 address in dotted decimal notation.
+func isIPv4(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+}
+
+// isIPv6 reports whether s is an IPv6 address.
+func isIPv6(s string) bool {
+	return net.ParseIP(s) != nil && strings.Contains(s, ":")
+}
@@ -0,0 +1,116 @@
+package jstn
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormats(t *testing.T) {
+
+	cases := []struct {
+		Format  string
+		Valid   []string
+		Invalid []string
+	}{
+		{
+			Format:  "date-time",
+			Valid:   []string{"2006-01-02T15:04:05Z", "2006-01-02t15:04:05.999z", "2006-01-02T15:04:05+07:00"},
+			Invalid: []string{"", "2006-01-02", "2006-01-02 15:04:05Z", "2006-01-02T15:04:05", "2006-13-02T15:04:05Z"},
+		},
+		{
+			Format:  "date",
+			Valid:   []string{"2006-01-02", "2024-02-29"},
+			Invalid: []string{"2006-1-2", "2023-02-29", "2006-01-02T15:04:05Z"},
+		},
+		{
+			Format:  "time",
+			Valid:   []string{"15:04:05Z", "23:59:59.5-08:00"},
+			Invalid: []string{"15:04", "25:00:00Z", "15:04:05"},
+		},
+		{
+			Format:  "uuid",
+			Valid:   []string{"123e4567-e89b-12d3-a456-426614174000", "123E4567-E89B-12D3-A456-426614174000"},
+			Invalid: []string{"123e4567e89b12d3a456426614174000", "123e4567-e89b-12d3-a456-42661417400g", "{123e4567-e89b-12d3-a456-426614174000}"},
+		},
+		{
+			Format:  "email",
+			Valid:   []string{"user@example.com", "first.last+tag@sub.example.org"},
+			Invalid: []string{"user", "@example.com", "User <user@example.com>", " user@example.com"},
+		},
+		{
+			Format:  "uri",
+			Valid:   []string{"https://example.com/a?b=c#d", "urn:isbn:0451450523", "mailto:user@example.com"},
+			Invalid: []string{"", "/relative/path", "example.com", "http://[::1"},
+		},
+		{
+			Format:  "ipv4",
+			Valid:   []string{"192.168.0.1", "0.0.0.0"},
+			Invalid: []string{"256.0.0.1", "1.2.3", "::ffff:192.168.0.1", "::1"},
+		},
+		{
+			Format:  "ipv6",
+			Valid:   []string{"::1", "2001:db8::ff00:42:8329", "::ffff:192.168.0.1"},
+			Invalid: []string{"192.168.0.1", "2001:db8:::1", "fe80::1%eth0"},
+		},
+	}
+
+	for _, c := range cases {
+		f, ok := lookupFormat(c.Format)
+		if !ok {
+			t.Errorf("format %s is not registered", c.Format)
+			continue
+		}
+		for _, s := range c.Valid {
+			if !f(s) {
+				t.Errorf("expected %q to be a valid %s", s, c.Format)
+			}
+		}
+		for _, s := range c.Invalid {
+			if f(s) {
+				t.Errorf("expected %q not to be a valid %s", s, c.Format)
+			}
+		}
+	}
+
+}
+
+func TestRegisterFormat(t *testing.T) {
+
+	RegisterFormat("test-sku", func(s string) bool {
+		return strings.HasPrefix(s, "SKU-")
+	})
+
+	schema := MustParse(`{sku: string<test-sku>}`)
+
+	if !Valid(schema, []byte(`{"sku":"SKU-123"}`)) {
+		t.Errorf("expected a valid sku")
+	}
+
+	err := Validate(schema, []byte(`{"sku":"123"}`))
+	expected := `jstn: /sku: "123" is not a valid test-sku`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected %q but got %v", expected, err)
+	}
+
+	// invalid registrations panic
+	for _, name := range []string{"", "9lives", "with space", "-sku"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a panic registering format %q", name)
+				}
+			}()
+			RegisterFormat(name, func(string) bool { return true })
+		}()
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected a panic registering a nil format")
+			}
+		}()
+		RegisterFormat("nil-format", nil)
+	}()
+
+}
@@ -2,8 +2,9 @@ package jstn
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
-	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -14,18 +15,122 @@ const indentationString = "  "
 // Generate formats t into a JSTN type declaration using the concise format
 // defined by the JSTN specification.
 func Generate(t Type) ([]byte, error) {
-	return (generator{Pretty: false}).generate(t, 0), nil
+	return GeneratorOptions{}.Generate(t)
 }
 
 // GeneratePretty formats t into a JSTN type declaration using the pretty
 // format defined by the JSTN specification.
 func GeneratePretty(t Type) ([]byte, error) {
-	return (generator{Pretty: true, Indentation: indentationString}).generate(t, 0), nil
+	return GeneratorOptions{Pretty: true}.Generate(t)
+}
+
+// GeneratorOptions configures how types are formatted as JSTN text. The zero
+// value selects the concise format.
+type GeneratorOptions struct {
+	// Pretty selects the pretty format.
+	Pretty bool
+
+	// Inline replaces each reference to a named type with the declaration of
+	// that type. Otherwise, the named types referred to are defined ahead of
+	// the type declaration. Even when inlining, a named type that refers to
+	// itself must still be defined, and is referred to by name within itself.
+	Inline bool
+}
+
+// Generate formats t into a JSTN document according to the options in o.
+func (o GeneratorOptions) Generate(t Type) ([]byte, error) {
+
+	g := generator{Pretty: o.Pretty}
+	if o.Pretty {
+		g.Indentation = indentationString
+	}
+
+	if !o.Inline {
+		var buf bytes.Buffer
+		imports, defs := definitions(t)
+		for _, ref := range imports {
+			g.writeImport(&buf, ref)
+		}
+		for _, ref := range defs {
+			g.writeDefinition(&buf, ref)
+		}
+		buf.Write(g.generate(t, 0))
+		return buf.Bytes(), nil
+	}
+
+	g.inline = &inliner{expanding: make(map[string]bool), defined: make(map[string]bool)}
+	body := g.generate(t, 0)
+
+	// defining a recursive type may lead to defining others
+	var buf bytes.Buffer
+	for i := 0; i < len(g.inline.recursive); i++ {
+		ref := g.inline.recursive[i]
+		g.inline.expanding[ref.Name] = true
+		g.writeDefinition(&buf, ref)
+		delete(g.inline.expanding, ref.Name)
+	}
+	buf.Write(body)
+
+	return buf.Bytes(), nil
+
 }
 
 type generator struct {
-	Pretty      bool   // Whether to render in pretty mode.
-	Indentation string // When in pretty mode, the indentation character to use.
+	Pretty      bool     // Whether to render in pretty mode.
+	Indentation string   // When in pretty mode, the indentation character to use.
+	inline      *inliner // When inlining named types, the state of doing so.
+}
+
+// An inliner tracks the named types being inlined, so that a named type is
+// referred to by name rather than inlined within itself. Those named types
+// must then be defined.
+type inliner struct {
+	expanding map[string]bool // the named types being inlined
+	defined   map[string]bool // the named types that must be defined
+	recursive []*Type         // references to those types, in order
+}
+
+// writeImport renders the import of the document defining the named type
+// that ref refers to.
+func (g generator) writeImport(w io.Writer, ref *Type) {
+
+	// token: import
+	io.WriteString(w, "import "+quote(ref.Import))
+	if ns := ref.Name[:strings.IndexByte(ref.Name, '.')]; ns != namespace(ref.Import) {
+		io.WriteString(w, " as "+ns)
+	}
+
+	// token: delimiter
+	if g.Pretty {
+		io.WriteString(w, "\n")
+	} else {
+		io.WriteString(w, ";")
+	}
+
+}
+
+// writeDefinition renders the definition of the named type ref refers to.
+func (g generator) writeDefinition(w io.Writer, ref *Type) {
+
+	// token: doc-comment
+	g.writeDescription(w, ref.Target.Description, 0)
+
+	// token: definition
+	io.WriteString(w, "type "+ref.Name)
+	if g.Pretty {
+		io.WriteString(w, " = ")
+	} else {
+		io.WriteString(w, "=")
+	}
+	w.Write(g.generate(*ref.Target, 0))
+
+	// token: delimiter, with a blank line between pretty definitions
+	if g.Pretty {
+		io.WriteString(w, "\n\n")
+	} else {
+		io.WriteString(w, ";")
+	}
+
 }
 
 // generate formats t into a JSTN document. Because it is a recursive function,
@@ -37,16 +142,51 @@ func (g generator) generate(t Type, depth int) []byte {
 	switch t.Kind {
 	case String:
 		io.WriteString(&buf, "string") // token: string
+		if t.Format != "" {
+			io.WriteString(&buf, "<"+t.Format+">") // token: format
+		}
 
 	case Number:
 		io.WriteString(&buf, "number") // token: number
 
+	case Integer:
+		io.WriteString(&buf, "integer") // token: integer
+
 	case Boolean:
 		io.WriteString(&buf, "boolean") // token: boolean
 
 	case Null:
 		io.WriteString(&buf, "null") // token: null
 
+	case Any:
+		io.WriteString(&buf, "any") // token: any
+
+	case Literal:
+		buf.Write(t.Value) // token: literal
+
+	case Reference:
+		if g.inline != nil && t.Target != nil {
+			if !g.inline.expanding[t.Name] {
+				// the named type, with the modifiers of the reference
+				target := *t.Target
+				target.Optional = target.Optional || t.Optional
+				target.Omittable = target.Omittable || t.Omittable
+				target.Nullable = target.Nullable || t.Nullable
+
+				g.inline.expanding[t.Name] = true
+				out := g.generate(target, depth)
+				delete(g.inline.expanding, t.Name)
+				return out
+			}
+
+			if !g.inline.defined[t.Name] {
+				g.inline.defined[t.Name] = true
+				ref := t
+				g.inline.recursive = append(g.inline.recursive, &ref)
+			}
+		}
+		io.WriteString(&buf, t.Name) // token: name
+
 	case Object:
 		io.WriteString(&buf, "{") // token: begin-object
 
@@ -57,12 +197,9 @@ func (g generator) generate(t Type, depth int) []byte {
 			}
 		}
 
-		// Sort property names for determinism.
-		var propertyNames []string
-		for k := range t.Properties {
-			propertyNames = append(propertyNames, k)
-		}
-		sort.Strings(propertyNames)
+		// Honour the declared property order, sorting any other names for
+		// determinism.
+		propertyNames := t.PropertyNames()
 
 		writePretty("\n")
 		for i, k := range propertyNames {
@@ -70,8 +207,18 @@ func (g generator) generate(t Type, depth int) []byte {
 			// In pretty mode, indent the property declaration line.
 			writePretty(strings.Repeat(g.Indentation, depth+1))
 
+			// token: doc-comment
+			g.writeDescription(&buf, t.Properties[k].Description, depth+1)
+
 			// token: name
-			io.WriteString(&buf, k)
+			if isName(k) {
+				io.WriteString(&buf, k)
+			} else {
+				io.WriteString(&buf, quote(k))
+			}
+			if t.Properties[k].Omittable {
+				io.WriteString(&buf, "?") // token: name-omittable
+			}
 
 			// token: name-separator
 			io.WriteString(&buf, ":")
@@ -80,13 +227,30 @@ func (g generator) generate(t Type, depth int) []byte {
 			// token: member
 			buf.Write(g.generate(*t.Properties[k], depth+1))
 
+			// token: default
+			if def := t.Properties[k].Default; def != nil {
+				if g.Pretty {
+					io.WriteString(&buf, " = ")
+				} else {
+					io.WriteString(&buf, "=")
+				}
+				buf.Write(def)
+			}
+
 			// token: delimiter
 			writePretty("\n")
-			if !g.Pretty && i < len(propertyNames)-1 {
+			if !g.Pretty && (i < len(propertyNames)-1 || t.Open) {
 				io.WriteString(&buf, ";")
 			}
 		}
 
+		if t.Open {
+			// token: open-marker
+			writePretty(strings.Repeat(g.Indentation, depth+1))
+			io.WriteString(&buf, "...")
+			writePretty("\n")
+		}
+
 		writePretty(strings.Repeat(g.Indentation, depth))
 		io.WriteString(&buf, "}") // token: end-object
 
@@ -99,6 +263,89 @@ func (g generator) generate(t Type, depth int) []byte {
 		}
 
 		io.WriteString(&buf, "]") // token: end-array
+
+	case Tuple:
+		io.WriteString(&buf, "[") // token: begin-array
+
+		for i, elem := range t.Elements {
+			// token: type-declaration
+			buf.Write(g.generate(*elem, depth))
+
+			// token: value-separator, which a lone element needs to
+			// distinguish the tuple from an array
+			if i < len(t.Elements)-1 {
+				io.WriteString(&buf, ",")
+				if g.Pretty {
+					io.WriteString(&buf, " ")
+				}
+			} else if len(t.Elements) == 1 {
+				io.WriteString(&buf, ",")
+			}
+		}
+
+		io.WriteString(&buf, "]") // token: end-array
+
+	case Map:
+		io.WriteString(&buf, "{") // token: begin-object
+		if g.Pretty {
+			io.WriteString(&buf, "\n"+strings.Repeat(g.Indentation, depth+1))
+		}
+
+		// token: index-signature
+		io.WriteString(&buf, "[")
+		if t.KeyPattern == "" {
+			io.WriteString(&buf, "string")
+		} else {
+			io.WriteString(&buf, quote(t.KeyPattern))
+		}
+		io.WriteString(&buf, "]")
+
+		// token: name-separator
+		io.WriteString(&buf, ":")
+		if g.Pretty {
+			io.WriteString(&buf, " ")
+		}
+
+		// token: type-declaration
+		if t.Values != nil {
+			buf.Write(g.generate(*t.Values, depth+1))
+		}
+
+		if g.Pretty {
+			io.WriteString(&buf, "\n"+strings.Repeat(g.Indentation, depth))
+		}
+		io.WriteString(&buf, "}") // token: end-object
+
+	case Union:
+		for i, alt := range t.Alternatives {
+			if i > 0 {
+				// token: union-separator
+				if g.Pretty {
+					io.WriteString(&buf, " | ")
+				} else {
+					io.WriteString(&buf, "|")
+				}
+			}
+
+			// token: concrete-type
+			a := *alt
+			a.Optional = false
+			buf.Write(g.generate(a, depth))
+		}
+	}
+
+	if t.Constraints != nil {
+		g.writeConstraints(&buf, t.Constraints) // token: constraints
+	}
+
+	if t.Nullable && t.Kind != Null {
+		// token: union-separator
+		if g.Pretty {
+			io.WriteString(&buf, " | ")
+		} else {
+			io.WriteString(&buf, "|")
+		}
+		io.WriteString(&buf, "null") // token: null
 	}
 
 	if t.Optional {
@@ -108,3 +355,140 @@ func (g generator) generate(t Type, depth int) []byte {
 	return buf.Bytes()
 
 }
+
+// writeConstraints renders the constraints set in c as a parenthesized list,
+// unless none are set.
+func (g generator) writeConstraints(w io.Writer, c *Constraints) {
+
+	var list []string
+	if c.Min != "" {
+		list = append(list, "min="+string(c.Min))
+	}
+	if c.Max != "" {
+		list = append(list, "max="+string(c.Max))
+	}
+	if c.MinLength != nil {
+		list = append(list, "minLength="+strconv.Itoa(*c.MinLength))
+	}
+	if c.MaxLength != nil {
+		list = append(list, "maxLength="+strconv.Itoa(*c.MaxLength))
+	}
+	if c.Pattern != "" {
+		list = append(list, "pattern="+quote(c.Pattern))
+	}
+	if c.MinItems != nil {
+		list = append(list, "minItems="+strconv.Itoa(*c.MinItems))
+	}
+	if c.MaxItems != nil {
+		list = append(list, "maxItems="+strconv.Itoa(*c.MaxItems))
+	}
+	if c.UniqueItems {
+		list = append(list, "uniqueItems")
+	}
+
+	if len(list) == 0 {
+		return
+	}
+
+	sep := ","
+	if g.Pretty {
+		sep = ", "
+	}
+	io.WriteString(w, "("+strings.Join(list, sep)+")")
+
+}
+
+// writeDescription renders the documentation comment for a property or a
+// definition. In pretty mode each line of the description becomes a line
+// comment, followed by the indentation for the next line. Because the concise
+// format has no newlines, each line instead becomes a block comment there.
+func (g generator) writeDescription(w io.Writer, desc string, depth int) {
+
+	if desc == "" {
+		return
+	}
+
+	for _, line := range strings.Split(desc, "\n") {
+		if g.Pretty {
+			io.WriteString(w, strings.TrimRight("/// "+line, " ")+"\n")
+			io.WriteString(w, strings.Repeat(g.Indentation, depth))
+		} else {
+			// a block comment can't contain its own terminator
+			line = strings.Replace(line, "*/", "* /", -1)
+			io.WriteString(w, "/** "+line+" */")
+		}
+	}
+
+}
+
+// isName reports whether s can name a property without being quoted.
+func isName(s string) bool {
+	for i, ch := range s {
+		if !isLetter(ch) && (i == 0 || !isDigit(ch) && ch != '_') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// quote renders s as a JSON string. Unlike json.Marshal, it leaves HTML
+// characters unescaped, which suits the regular expressions and values that
+// are quoted.
+func quote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// definitions lists the resolved references to distinct named types that are
+// reachable from t, in the order they are first encountered. References to
+// imported types are listed separately, once for each namespace, and the
+// imported types aren't explored.
+func definitions(t Type) (imports, refs []*Type) {
+
+	seen := make(map[string]bool)       // names of the types listed
+	namespaces := make(map[string]bool) // namespaces of the imports listed
+
+	var walk func(t *Type)
+	walk = func(t *Type) {
+		switch t.Kind {
+		case Reference:
+			if i := strings.IndexByte(t.Name, '.'); i >= 0 && t.Import != "" {
+				if ns := t.Name[:i]; !namespaces[ns] {
+					namespaces[ns] = true
+					imports = append(imports, t)
+				}
+			} else if t.Target != nil && !seen[t.Name] {
+				seen[t.Name] = true
+				refs = append(refs, t)
+				walk(t.Target)
+			}
+		case Object:
+			for _, k := range t.PropertyNames() {
+				walk(t.Properties[k])
+			}
+		case Array:
+			if t.Items != nil {
+				walk(t.Items)
+			}
+		case Tuple:
+			for _, et := range t.Elements {
+				walk(et)
+			}
+		case Map:
+			if t.Values != nil {
+				walk(t.Values)
+			}
+		case Union:
+			for _, at := range t.Alternatives {
+				walk(at)
+			}
+		}
+	}
+
+	walk(&t)
+	return imports, refs
+
+}
@@ -1,6 +1,10 @@
 package jstn
 
-import "testing"
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
 
 func TestGenerator(t *testing.T) {
 
@@ -125,6 +129,280 @@ func TestGenerator(t *testing.T) {
 }?`,
 			Pretty: true,
 		},
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"isbn":  &Type{Kind: String, Description: "The ISBN-13 of the work."},
+				"title": &Type{Kind: String, Description: "The title,\nin the original */ language."},
+			}},
+			String: "{/** The ISBN-13 of the work. */isbn:string;/** The title, *//** in the original * / language. */title:string}",
+		},
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"isbn": &Type{Kind: String, Description: "The ISBN-13 of the work."},
+				"work": &Type{Kind: Object, Description: "The work.\n\nSee the catalogue.", Properties: map[string]*Type{
+					"title": &Type{Kind: String, Description: "The title."},
+				}},
+			}},
+			String: `{
+  /// The ISBN-13 of the work.
+  isbn: string
+  /// The work.
+  ///
+  /// See the catalogue.
+  work: {
+    /// The title.
+    title: string
+  }
+}`,
+			Pretty: true,
+		},
+		//
+		// UNIONS
+		//
+
+		{
+			Type: Type{Kind: Union, Optional: true, Alternatives: []*Type{
+				&Type{Kind: String},
+				&Type{Kind: Number, Optional: true}, // not representable
+			}},
+			String: "string|number?",
+		},
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"id": &Type{Kind: Union, Alternatives: []*Type{
+					&Type{Kind: String},
+					&Type{Kind: Object, Properties: map[string]*Type{
+						"number": &Type{Kind: Number},
+					}},
+				}},
+			}},
+			String: `{
+  id: string | {
+    number: number
+  }
+}`,
+			Pretty: true,
+		},
+		{
+			Type:   Type{Kind: Array, Items: &Type{Kind: Integer, Optional: true}},
+			String: "[integer?]",
+		},
+		//
+		// TUPLES
+		//
+
+		{
+			Type: Type{Kind: Tuple, Elements: []*Type{
+				&Type{Kind: String},
+				&Type{Kind: Number},
+				&Type{Kind: Boolean, Optional: true},
+			}},
+			String: "[string,number,boolean?]",
+		},
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"pair": &Type{Kind: Tuple, Optional: true, Elements: []*Type{
+					&Type{Kind: String},
+					&Type{Kind: Array, Items: &Type{Kind: Number}},
+				}},
+				"single": &Type{Kind: Tuple, Elements: []*Type{
+					&Type{Kind: String},
+				}},
+			}, Order: []string{"pair", "single"}},
+			String: `{
+  pair: [string, [number]]?
+  single: [string,]
+}`,
+			Pretty: true,
+		},
+		//
+		// OPEN OBJECTS
+		//
+
+		{
+			Type: Type{Kind: Object, Open: true, Properties: map[string]*Type{
+				"id":    &Type{Kind: String},
+				"extra": &Type{Kind: Object, Open: true},
+			}, Order: []string{"id", "extra"}},
+			String: "{id:string;extra:{...};...}",
+		},
+		{
+			Type: Type{Kind: Object, Open: true, Properties: map[string]*Type{
+				"id":    &Type{Kind: String},
+				"extra": &Type{Kind: Object, Open: true},
+			}, Order: []string{"id", "extra"}},
+			String: `{
+  id: string
+  extra: {...}
+  ...
+}`,
+			Pretty: true,
+		},
+
+		//
+		// ANY
+		//
+
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"metadata": &Type{Kind: Any, Optional: true},
+				"tags":     &Type{Kind: Array, Items: &Type{Kind: Any}},
+			}, Order: []string{"metadata", "tags"}},
+			String: "{metadata:any?;tags:[any]}",
+		},
+		{
+			Type:   MustParse("{extra: object; list: array}"),
+			String: "{extra:{...};list:[any]}",
+		},
+
+		//
+		// QUOTED NAMES
+		//
+
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"content-type": &Type{Kind: String},
+				"@id":          &Type{Kind: String, Omittable: true},
+				"x.y":          &Type{Kind: Number},
+				"café":         &Type{Kind: Number},
+				"a<b>":         &Type{Kind: Number},
+				"_private":     &Type{Kind: Number},
+				"9lives":       &Type{Kind: Number},
+				"":             &Type{Kind: Number},
+				"snake_case2":  &Type{Kind: Number},
+				"null":         &Type{Kind: Number},
+			}, Order: []string{"content-type", "@id", "x.y", "café", "a<b>", "_private", "9lives", "", "snake_case2", "null"}},
+			String: `{"content-type":string;"@id"?:string;"x.y":number;"café":number;"a<b>":number;"_private":number;"9lives":number;"":number;snake_case2:number;null:number}`,
+		},
+
+		//
+		// CONSTRAINTS
+		//
+
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"age":  &Type{Kind: Integer, Constraints: &Constraints{Min: "0", Max: "150"}},
+				"name": &Type{Kind: String, Optional: true, Constraints: &Constraints{MinLength: intPtr(1), MaxLength: intPtr(64), Pattern: `^<[a-z"]+>$`}},
+				"tags": &Type{Kind: Array, Nullable: true, Items: &Type{Kind: String}, Constraints: &Constraints{MinItems: intPtr(0), UniqueItems: true}},
+				"none": &Type{Kind: Number, Constraints: &Constraints{}},
+			}, Order: []string{"age", "name", "tags", "none"}},
+			String: `{age:integer(min=0,max=150);name:string(minLength=1,maxLength=64,pattern="^<[a-z\"]+>$")?;tags:[string](minItems=0,uniqueItems)|null;none:number}`,
+		},
+		{
+			Type:   MustParse(`{age: integer(min=0, max=150)}`),
+			String: "{\n  age: integer(min=0, max=150)\n}",
+			Pretty: true,
+		},
+
+		//
+		// FORMATS
+		//
+
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"id":      &Type{Kind: String, Format: "uuid"},
+				"created": &Type{Kind: String, Format: "date-time", Optional: true, Constraints: &Constraints{MinLength: intPtr(20)}},
+			}, Order: []string{"id", "created"}},
+			String: "{id:string<uuid>;created:string<date-time>(minLength=20)?}",
+		},
+
+		//
+		// DEFAULTS
+		//
+
+		{
+			Type:   MustParse(`{retries: number? = 3; tags?: [string] = ["a", "b"]}`),
+			String: `{retries:number?=3;tags?:[string]=["a","b"]}`,
+		},
+		{
+			Type:   MustParse(`{retries: number? = 3; mode?: string | null = null}`),
+			String: "{\n  retries: number? = 3\n  mode?: string | null = null\n}",
+			Pretty: true,
+		},
+
+		//
+		// NAMED TYPES
+		//
+
+		{
+			Type:   MustParse("type A = {b: B?}\ntype B = [string]\n{x: A; y: [B]; z: A?}"),
+			String: "type A={b:B?};type B=[string];{x:A;y:[B];z:A?}",
+		},
+		{
+			Type: MustParse("/// A point.\ntype Point = [number, number]\n{from: Point; to: Point}"),
+			String: `/// A point.
+type Point = [number, number]
+
+{
+  from: Point
+  to: Point
+}`,
+			Pretty: true,
+		},
+		{
+			Type:   MustParse("type Node = {name: string; children: [Node]?}\n{root: Node}"),
+			String: "type Node={name:string;children:[Node]?};{root:Node}",
+		},
+		{
+			// A reference without a target is rendered without a definition.
+			Type:   Type{Kind: Array, Items: &Type{Kind: Reference, Name: "Elsewhere"}},
+			String: "[Elsewhere]",
+		},
+		//
+		// MAPS
+		//
+
+		{
+			Type:   Type{Kind: Map, Optional: true, Values: &Type{Kind: Number}},
+			String: "{[string]:number}?",
+		},
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"labels": &Type{Kind: Map, KeyPattern: "^<[a-z]+>$", Values: &Type{Kind: Object, Properties: map[string]*Type{
+					"text": &Type{Kind: String},
+				}}},
+			}},
+			String: `{
+  labels: {
+    ["^<[a-z]+>$"]: {
+      text: string
+    }
+  }
+}`,
+			Pretty: true,
+		},
+		//
+		// LITERALS
+		//
+
+		{
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"status": &Type{Kind: Union, Alternatives: []*Type{
+					&Type{Kind: Literal, Value: json.RawMessage(`"active"`)},
+					&Type{Kind: Literal, Value: json.RawMessage(`"deleted"`)},
+				}},
+				"version": &Type{Kind: Literal, Optional: true, Value: json.RawMessage(`2`)},
+			}, Order: []string{"status", "version"}},
+			String: `{status:"active"|"deleted";version:2?}`,
+		},
+		{
+			// The declared property order is honoured.
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"firstName": &Type{Kind: String},
+				"age":       &Type{Kind: Number, Optional: true},
+				"id":        &Type{Kind: Number},
+			}, Order: []string{"id", "firstName", "age"}},
+			String: "{id:number;firstName:string;age:number?}",
+		},
+		{
+			// Properties missing from the order follow it, sorted by name.
+			Type: Type{Kind: Object, Properties: map[string]*Type{
+				"firstName": &Type{Kind: String},
+				"age":       &Type{Kind: Number, Optional: true},
+				"id":        &Type{Kind: Number},
+			}, Order: []string{"id", "unknown"}},
+			String: "{id:number;age:number?;firstName:string}",
+		},
 	}
 
 	for i, c := range cases {
@@ -152,3 +430,116 @@ func TestGenerator(t *testing.T) {
 	}
 
 }
+
+func TestGeneratorOptions_Inline(t *testing.T) {
+
+	schema := MustParse(`type Address = {street: string; zip: string?}
+type MaybeID = integer?
+{home: Address; work: Address?; id: MaybeID}`)
+
+	out, err := GeneratorOptions{Inline: true}.Generate(schema)
+	if err != nil {
+		t.Fatalf("unexpected generator error: %s", err)
+	}
+
+	expected := "{home:{street:string;zip:string?};work:{street:string;zip:string?}?;id:integer?}"
+	if string(out) != expected {
+		t.Errorf("unexpected production: expected %q but got %q", expected, out)
+	}
+
+}
+
+func TestGeneratorOptions_InlineRecursive(t *testing.T) {
+
+	cases := []struct {
+		Schema string
+		String string
+	}{
+		{
+			Schema: "type Node = {name: string; children: [Node]}\n{tree: Node?}",
+			String: "type Node={name:string;children:[Node]};{tree:{name:string;children:[Node]}?}",
+		},
+		{
+			Schema: "type A = {b: B?}\ntype B = {a: A?; c: C}\ntype C = string\nA",
+			String: "type A={b:{a:A?;c:string}?};{b:{a:A?;c:string}?}",
+		},
+	}
+
+	for i, c := range cases {
+
+		out, err := GeneratorOptions{Inline: true}.Generate(MustParse(c.Schema))
+		if err != nil {
+			t.Errorf("[case %d] unexpected generator error: %s", i, err)
+			continue
+		}
+
+		if string(out) != c.String {
+			t.Errorf("[case %d] unexpected production: expected %q but got %q", i, c.String, out)
+		}
+
+	}
+
+}
+
+func TestGenerator_RoundTrip(t *testing.T) {
+
+	schema := `{
+  /// The identifier.
+  id: number
+  name: string
+  works: [{
+    title: string
+    year: number?
+  }]
+  metadata: {
+    updated: string
+    created: string
+  }?
+  manager: {
+    id: number
+  } | null
+  nickname?: string | null
+  retries: integer? = 3
+  tags?: [string] = ["a","b"]
+}`
+
+	out, err := GeneratePretty(MustParse(schema))
+	if err != nil {
+		t.Fatalf("unexpected generator error: %s", err)
+	}
+
+	if string(out) != schema {
+		t.Errorf("unexpected production: expected\n%s\nbut got\n%s", schema, out)
+	}
+
+}
+
+func TestGenerator_RoundTripConcise(t *testing.T) {
+
+	schema := MustParse(`{
+	/// The title,
+	/// in its original language.
+	title: string
+	year: number?
+	isbn?: string
+	publisher: {name: string} | null
+	editions?: [[number, string | null]] | null
+	"content-type": string
+	"\"quoted\"\t": string
+	rating: number(min=-1e2, max=1.5)?
+	code: string(pattern="^\\d+$", maxLength=8)
+	ids: array(minItems=1, maxItems=10, uniqueItems) | null
+	updated: string<date-time>(pattern="Z$") | null
+	limits?: {max: number} = {"max": 1e3}
+}`)
+
+	out, err := Generate(schema)
+	if err != nil {
+		t.Fatalf("unexpected generator error: %s", err)
+	}
+
+	if parsed := MustParse(string(out)); !reflect.DeepEqual(parsed, schema) {
+		t.Errorf("unexpected round trip through %q: expected\n%# v\nbut got\n%# v", out, schema, parsed)
+	}
+
+}
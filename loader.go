@@ -0,0 +1,95 @@
+package jstn
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// A Loader parses JSTN documents from a file system, along with the documents
+// they import. An import path is relative to the directory of the importing
+// document, unless it begins with a slash, in which case it is relative to
+// the root of the file system.
+//
+// Each document is parsed at most once by a Loader, so a named type imported
+// by several documents is the same Type in each of them. A Loader is not safe
+// for concurrent use by multiple goroutines.
+type Loader struct {
+	fsys    fs.FS
+	docs    map[string]*document // the documents parsed so far, by name
+	loading []string             // the documents being parsed, in import order
+}
+
+// NewLoader returns a Loader that reads documents from fsys.
+func NewLoader(fsys fs.FS) *Loader {
+	return &Loader{fsys: fsys, docs: make(map[string]*document)}
+}
+
+// Load parses the document with the given name, which must include a type
+// declaration, and returns the type it declares. Errors in any document are
+// reported as a *ParseError whose position names the offending file. An error
+// concerning the named document as a whole, such as failing to read it, has a
+// position with only the file name, and wraps any underlying error.
+func (l *Loader) Load(name string) (Type, error) {
+
+	doc, err := l.load(name, true)
+	if err != nil {
+		if _, ok := err.(*ParseError); !ok {
+			err = &ParseError{Pos: Position{Filename: name}, Message: err.Error(), Err: err}
+		}
+		return Type{}, err
+	}
+	return *doc.root, nil
+
+}
+
+// load parses the named document, unless it has already been parsed.
+func (l *Loader) load(name string, declaration bool) (*document, error) {
+
+	if doc, ok := l.docs[name]; ok {
+		if declaration && doc.root == nil {
+			return nil, errors.New("no type declaration")
+		}
+		return doc, nil
+	}
+
+	for i, loading := range l.loading {
+		if loading == name {
+			cycle := append(append([]string{}, l.loading[i:]...), name)
+			return nil, fmt.Errorf("import cycle %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	src, err := fs.ReadFile(l.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{s: newScanner(strings.NewReader(string(src))), src: string(src)}
+	p.s.pos.Filename = name
+	p.load = func(importPath string) (*document, error) {
+		return l.load(l.resolve(name, importPath), false)
+	}
+
+	l.loading = append(l.loading, name)
+	doc, err := p.parseDocument(declaration)
+	l.loading = l.loading[:len(l.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	l.docs[name] = doc
+	return doc, nil
+
+}
+
+// resolve determines the name of the document that the document named from
+// imports by importPath.
+func (l *Loader) resolve(from, importPath string) string {
+	if strings.HasPrefix(importPath, "/") {
+		return path.Clean(importPath[1:])
+	}
+	return path.Join(path.Dir(from), importPath)
+}
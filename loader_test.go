@@ -0,0 +1,164 @@
+package jstn
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoader(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"api/person.jstn": {Data: []byte(`import "../common/address.jstn"
+import "/common/id.jstn" as ids
+
+type Person = {
+	id: ids.ID
+	home: address.Address
+	work: address.Address?
+}
+
+{people: [Person]}`)},
+		"common/address.jstn": {Data: []byte(`import "id.jstn"
+
+/// A postal address.
+type Address = {street: string; city: string; id: id.ID?}
+`)},
+		"common/id.jstn": {Data: []byte(`type ID = string | integer`)},
+	}
+
+	schema, err := NewLoader(fsys).Load("api/person.jstn")
+	if err != nil {
+		t.Fatalf("unexpected load error: %s", err)
+	}
+
+	person := schema.Properties["people"].Items.Target
+	id := person.Properties["id"]
+	home := person.Properties["home"]
+
+	expected := &Type{Kind: Reference, Name: "ids.ID", Import: "/common/id.jstn", Target: &Type{Kind: Union, Alternatives: []*Type{
+		&Type{Kind: String},
+		&Type{Kind: Integer},
+	}}}
+	if !reflect.DeepEqual(id, expected) {
+		t.Errorf("unexpected id: expected\n%# v\nbut got\n%# v", expected, id)
+	}
+
+	if home.Name != "address.Address" || home.Import != "../common/address.jstn" || home.Target.Description != "A postal address." {
+		t.Errorf("unexpected home: %# v", home)
+	}
+
+	// both documents that import id.jstn share its definitions
+	if home.Target.Properties["id"].Target != id.Target {
+		t.Errorf("unexpected target of address id: %p rather than %p", home.Target.Properties["id"].Target, id.Target)
+	}
+
+	if !Valid(schema, []byte(`{"people":[{"id":1,"home":{"street":"a","city":"b","id":"c"}}]}`)) {
+		t.Errorf("expected document to be valid")
+	}
+
+	// imports are reproduced when generating
+	out, err := Generate(schema)
+	if err != nil {
+		t.Fatalf("unexpected generator error: %s", err)
+	}
+
+	generated := `import "/common/id.jstn" as ids;import "../common/address.jstn";type Person={id:ids.ID;home:address.Address;work:address.Address?};{people:[Person]}`
+	if string(out) != generated {
+		t.Errorf("unexpected production: expected %q but got %q", generated, out)
+	}
+
+}
+
+func TestLoader_Errors(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"cycle/a.jstn":       {Data: []byte("import \"b.jstn\"\nb.B")},
+		"cycle/b.jstn":       {Data: []byte("import \"c.jstn\"\ntype B = c.C")},
+		"cycle/c.jstn":       {Data: []byte("import \"a.jstn\"\ntype C = string")},
+		"missing.jstn":       {Data: []byte("import \"nowhere.jstn\"\nstring")},
+		"undefined.jstn":     {Data: []byte("import \"lib.jstn\"\nlib.Missing")},
+		"namespace.jstn":     {Data: []byte("import \"lib.jstn\"\nimport \"other/lib.jstn\"\nstring")},
+		"broken.jstn":        {Data: []byte("import \"lib.jstn\"; import \"bad.jstn\"\nstring")},
+		"lib.jstn":           {Data: []byte("type Name = string\n")},
+		"other/lib.jstn":     {Data: []byte("type Name = string\n")},
+		"bad.jstn":           {Data: []byte("type Bad = {a: string b: string}\n")},
+		"nodeclaration.jstn": {Data: []byte("type Name = string\n")},
+		"uses.jstn":          {Data: []byte("import \"lib.jstn\"\nlib.Name")},
+	}
+
+	cases := []struct {
+		Name  string
+		Error string
+	}{
+		{
+			Name:  "cycle/a.jstn",
+			Error: `jstn: cycle/c.jstn:1:8: cannot import "a.jstn": import cycle cycle/a.jstn -> cycle/b.jstn -> cycle/c.jstn -> cycle/a.jstn`,
+		},
+		{
+			Name:  "missing.jstn",
+			Error: `jstn: missing.jstn:1:8: cannot import "nowhere.jstn": open nowhere.jstn: file does not exist`,
+		},
+		{
+			Name:  "undefined.jstn",
+			Error: `jstn: undefined.jstn:2:1: undefined type lib.Missing`,
+		},
+		{
+			Name:  "namespace.jstn",
+			Error: `jstn: namespace.jstn:2:8: namespace lib is already in use`,
+		},
+		{
+			Name:  "broken.jstn",
+			Error: `jstn: bad.jstn:1:23: unexpected identifier, expected ";" or newline or "}"`,
+		},
+		{
+			Name:  "nodeclaration.jstn",
+			Error: `jstn: nodeclaration.jstn:2:1: unexpected end of input, expected "string" or "number" or "integer" or "boolean" or "null" or "any" or "object" or "array" or string literal or number literal or identifier or "[" or "{"`,
+		},
+		{
+			Name:  "nowhere.jstn",
+			Error: `jstn: nowhere.jstn: open nowhere.jstn: file does not exist`,
+		},
+	}
+
+	for i, c := range cases {
+		_, err := NewLoader(fsys).Load(c.Name)
+		if err == nil || err.Error() != c.Error {
+			t.Errorf("[case %d] unexpected error: expected %q but got %v", i, c.Error, err)
+		}
+	}
+
+	// an error in an imported file is a *ParseError locating it
+	_, err := NewLoader(fsys).Load("broken.jstn")
+	if perr, ok := err.(*ParseError); !ok || perr.Pos.Filename != "bad.jstn" {
+		t.Errorf("unexpected error: %#v", err)
+	}
+
+	// so is an error concerning the named file as a whole, which wraps any
+	// underlying error
+	_, err = NewLoader(fsys).Load("nowhere.jstn")
+	if perr, ok := err.(*ParseError); !ok || perr.Pos.Filename != "nowhere.jstn" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unexpected error: %#v", err)
+	}
+
+	// a document that lacks a type declaration can't be loaded, even if it
+	// has already been imported
+	l := NewLoader(fsys)
+	if _, err := l.Load("uses.jstn"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = l.Load("lib.jstn")
+	if expected := `jstn: lib.jstn: no type declaration`; err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected %q but got %v", expected, err)
+	}
+
+	// imports aren't possible without a Loader
+	_, err = Parse("import \"lib.jstn\"\nstring")
+	expected := `jstn: 1:8: cannot import "lib.jstn" without a Loader`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected %q but got %v", expected, err)
+	}
+
+}
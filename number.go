@@ -0,0 +1,160 @@
+package jstn
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// A decimal is a JSON number in a canonical form that allows numbers to be
+// compared exactly, however many digits they have. Its value is
+// 0.digits × 10^exp, negated if neg is set, where digits has no leading or
+// trailing zeros. Zero has no digits.
+type decimal struct {
+	neg    bool
+	digits string
+	exp    int
+}
+
+// maxExponent bounds the exponents of decimals, so that absurdly large
+// exponents in a JSON text can't overflow. Any number with a larger exponent
+// compares as if its exponent were maxExponent.
+const maxExponent = 1 << 30
+
+// parseDecimal converts the text of a JSON number to a decimal. It reports
+// whether n is a valid JSON number.
+func parseDecimal(n json.Number) (decimal, bool) {
+
+	s := string(n)
+	if s == "" || (s[0] != '-' && !isDigit(rune(s[0]))) || !json.Valid([]byte(s)) {
+		return decimal{}, false
+	}
+
+	var d decimal
+	if s[0] == '-' {
+		d.neg, s = true, s[1:]
+	}
+
+	// split off the exponent
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, sign := s[i+1:], int64(1)
+		if e[0] == '-' || e[0] == '+' {
+			if e[0] == '-' {
+				sign = -1
+			}
+			e = e[1:]
+		}
+
+		e64 := int64(maxExponent)
+		if e = strings.TrimLeft(e, "0"); e == "" {
+			e64 = 0
+		} else if len(e) <= 10 {
+			e64, _ = strconv.ParseInt(e, 10, 64)
+		}
+
+		exp = int(clamp(sign*e64, -maxExponent, maxExponent))
+		s = s[:i]
+	}
+
+	// the digits before the point contribute to the exponent
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	digits := strings.TrimLeft(intPart, "0")
+	exp += len(digits)
+	if digits == "" {
+		// all the significant digits are after the point
+		trimmed := strings.TrimLeft(fracPart, "0")
+		exp -= len(fracPart) - len(trimmed)
+		fracPart = trimmed
+	}
+	digits = strings.TrimRight(digits+fracPart, "0")
+
+	if digits == "" {
+		// zero, whose sign and exponent are immaterial
+		return decimal{}, true
+	}
+
+	d.digits, d.exp = digits, int(clamp(int64(exp), -maxExponent, maxExponent))
+	return d, true
+
+}
+
+// isInteger reports whether d has no fractional part, as do 10, 1e3 and 2.0.
+func (d decimal) isInteger() bool {
+	return d.exp >= len(d.digits)
+}
+
+// String renders d as a JSON number in the canonical form 0.digits e exp, or
+// as 0, so that equal decimals render equally.
+func (d decimal) String() string {
+	if d.digits == "" {
+		return "0"
+	}
+	s := "0." + d.digits + "e" + strconv.Itoa(d.exp)
+	if d.neg {
+		s = "-" + s
+	}
+	return s
+}
+
+func clamp(n, min, max int64) int64 {
+	if n < min {
+		return min
+	} else if n > max {
+		return max
+	}
+	return n
+}
+
+// cmp compares d and e, returning -1, 0 or +1 as d is less than, equal to, or
+// greater than e.
+func (d decimal) cmp(e decimal) int {
+
+	// compare signs, treating zero as positive
+	if d.neg != e.neg {
+		if d.neg {
+			return -1
+		}
+		return +1
+	}
+
+	// compare magnitudes, then account for the shared sign
+	c := d.cmpAbs(e)
+	if d.neg {
+		return -c
+	}
+	return c
+
+}
+
+func (d decimal) cmpAbs(e decimal) int {
+
+	switch {
+	case d.digits == "" && e.digits == "":
+		return 0
+	case d.digits == "":
+		return -1
+	case e.digits == "":
+		return +1
+	case d.exp != e.exp:
+		if d.exp < e.exp {
+			return -1
+		}
+		return +1
+	}
+
+	// with equal exponents, the digit strings compare lexically, with a
+	// missing digit being less than any other
+	switch {
+	case d.digits < e.digits:
+		return -1
+	case d.digits > e.digits:
+		return +1
+	}
+	return 0
+
+}
@@ -0,0 +1,121 @@
+package jstn
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+
+	cases := []struct {
+		Number  json.Number
+		Decimal decimal
+		OK      bool
+	}{
+		{Number: "0", Decimal: decimal{}, OK: true},
+		{Number: "-0.000e12", Decimal: decimal{}, OK: true},
+		{Number: "12", Decimal: decimal{digits: "12", exp: 2}, OK: true},
+		{Number: "1200", Decimal: decimal{digits: "12", exp: 4}, OK: true},
+		{Number: "12e2", Decimal: decimal{digits: "12", exp: 4}, OK: true},
+		{Number: "-1.5", Decimal: decimal{neg: true, digits: "15", exp: 1}, OK: true},
+		{Number: "0.0015", Decimal: decimal{digits: "15", exp: -2}, OK: true},
+		{Number: "15E-0004", Decimal: decimal{digits: "15", exp: -2}, OK: true},
+		{Number: "1e99999999999999999999", Decimal: decimal{digits: "1", exp: maxExponent}, OK: true},
+		{Number: "1e-99999999999999999999", Decimal: decimal{digits: "1", exp: -maxExponent + 1}, OK: true},
+		{Number: "", OK: false},
+		{Number: "-", OK: false},
+		{Number: "01", OK: false},
+		{Number: "1.", OK: false},
+		{Number: `"1"`, OK: false},
+		{Number: "true", OK: false},
+	}
+
+	for i, c := range cases {
+		d, ok := parseDecimal(c.Number)
+		if ok != c.OK || (ok && d != c.Decimal) {
+			t.Errorf("[case %d] unexpected parse of %q: expected %+v (%t) but got %+v (%t)", i, c.Number, c.Decimal, c.OK, d, ok)
+		}
+	}
+
+}
+
+func TestDecimalIsInteger(t *testing.T) {
+
+	cases := map[json.Number]bool{
+		"0":                       true,
+		"-0.0":                    true,
+		"10":                      true,
+		"1e3":                     true,
+		"1.5e1":                   true,
+		"2.000":                   true,
+		"123456789012345678901":   true,
+		"1e99999999999999999999":  true,
+		"1.5":                     false,
+		"0.1":                     false,
+		"15e-1":                   false,
+		"1e-99999999999999999999": false,
+		"9007199254740993.5":      false,
+	}
+
+	for n, expected := range cases {
+		d, _ := parseDecimal(n)
+		if actual := d.isInteger(); actual != expected {
+			t.Errorf("unexpected integrality of %s: expected %t but got %t", n, expected, actual)
+		}
+	}
+
+}
+
+func TestDecimalString(t *testing.T) {
+
+	cases := map[json.Number]string{
+		"0":       "0",
+		"-0.0e5":  "0",
+		"1":       "0.1e1",
+		"1.0":     "0.1e1",
+		"10e-1":   "0.1e1",
+		"-120":    "-0.12e3",
+		"0.00125": "0.125e-2",
+	}
+
+	for n, expected := range cases {
+		d, _ := parseDecimal(n)
+		if actual := d.String(); actual != expected {
+			t.Errorf("unexpected string for %s: expected %q but got %q", n, expected, actual)
+		}
+	}
+
+}
+
+func TestDecimalCmp(t *testing.T) {
+
+	cases := []struct {
+		A, B json.Number
+		Cmp  int
+	}{
+		{A: "2", B: "2.0", Cmp: 0},
+		{A: "2", B: "20e-1", Cmp: 0},
+		{A: "0", B: "-0", Cmp: 0},
+		{A: "1", B: "2", Cmp: -1},
+		{A: "0.2", B: "0.19", Cmp: +1},
+		{A: "0.12", B: "0.123", Cmp: -1},
+		{A: "-1", B: "1", Cmp: -1},
+		{A: "-1", B: "-2", Cmp: +1},
+		{A: "-1", B: "0", Cmp: -1},
+		{A: "0", B: "0.0001", Cmp: -1},
+		{A: "100", B: "99.9999", Cmp: +1},
+		{A: "9007199254740993", B: "9007199254740992", Cmp: +1},
+	}
+
+	for i, c := range cases {
+		a, _ := parseDecimal(c.A)
+		b, _ := parseDecimal(c.B)
+		if cmp := a.cmp(b); cmp != c.Cmp {
+			t.Errorf("[case %d] unexpected comparison of %s and %s: expected %d but got %d", i, c.A, c.B, c.Cmp, cmp)
+		}
+		if cmp := b.cmp(a); cmp != -c.Cmp {
+			t.Errorf("[case %d] unexpected comparison of %s and %s: expected %d but got %d", i, c.B, c.A, -c.Cmp, cmp)
+		}
+	}
+
+}
@@ -2,15 +2,18 @@
 package jstn
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"log"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 // Parse parses a JSTN text into a native representation.
 func Parse(schema string) (Type, error) {
 	r := strings.NewReader(schema)
-	p := &parser{s: newScanner(r)}
+	p := &parser{s: newScanner(r), src: schema}
 	return p.Parse()
 }
 
@@ -23,20 +26,87 @@ func MustParse(schema string) Type {
 	return t
 }
 
+// A ParseError describes a syntax error in a JSTN text.
+type ParseError struct {
+	Pos      Position // the position of the offending token
+	Found    string   // a description of the offending token
+	Literal  string   // the text of the offending token
+	Expected []string // descriptions of the tokens that would have been accepted
+	Snippet  string   // the offending line, followed by a line with a caret under Pos
+	Message  string   // for errors other than unexpected tokens, a description of the error
+	Err      error    // the underlying error, if any, such as one reading a file
+}
+
+func (e *ParseError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("jstn: %s: %s", e.Pos, e.Message)
+	}
+	msg := fmt.Sprintf("jstn: %s: unexpected %s", e.Pos, e.Found)
+	if len(e.Expected) > 0 {
+		msg += ", expected " + strings.Join(e.Expected, " or ")
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error, if any.
+func (e *ParseError) Unwrap() error { return e.Err }
+
 type parser struct {
-	s   *scanner
+	s    *scanner
+	src  string           // the text being parsed, for error snippets
+	doc  []string         // the documentation comments preceding the last token
+	defs map[string]*Type // the named types defined so far
+	decl []reference      // the definitions of named types, in order
+	refs []reference      // the references to named types, in order
+
+	// defaults holds the properties with default values, which can only be
+	// checked against their types once references are resolved
+	defaults []defaulted
+
+	// load reads the document at an import path, or is nil if imports
+	// aren't supported. imports holds the documents imported, by namespace.
+	load    func(path string) (*document, error)
+	imports map[string]imported
+
 	buf struct {
 		tok token
 		lit string
+		pos Position
 		n   int
 	}
 }
 
+// A reference records where a named type was defined or referred to, so
+// that problems can be reported once the whole text has been parsed.
+type reference struct {
+	name string
+	pos  Position
+}
+
+// A defaulted property type is one with a default value at pos.
+type defaulted struct {
+	t   *Type
+	pos Position
+}
+
+// A document is a parsed JSTN text.
+type document struct {
+	defs map[string]*Type // the named types defined by the text
+	root *Type            // the type declaration, if the text has one
+}
+
+// An imported document is one that another imports under some namespace.
+type imported struct {
+	path string // the import path, as written
+	doc  *document
+}
+
 func (p *parser) scan() (tok token, lit string) {
 	if p.buf.n != 0 {
 		p.buf.n = 0
 		return p.buf.tok, p.buf.lit
 	}
+	p.buf.pos = p.s.pos
 	p.buf.tok, p.buf.lit = p.s.Scan()
 	tok, lit = p.buf.tok, p.buf.lit
 	return
@@ -44,16 +114,392 @@ func (p *parser) scan() (tok token, lit string) {
 
 func (p *parser) unscan() { p.buf.n = 1 }
 
+// scanIgnoreWhitespace scans the next token that isn't whitespace or a
+// comment, collecting the text of any documentation comments in p.doc.
+// Unless ignoreNewlines is set, a newline ends the search, and a block
+// comment spanning multiple lines counts as one.
 func (p *parser) scanIgnoreWhitespace(ignoreNewlines bool) (tok token, lit string) {
-	tok, lit = p.scan()
-	for tok == WHITESPACE || (ignoreNewlines && tok == NEWLINE) {
+	p.doc = nil
+	for {
 		tok, lit = p.scan()
+		switch {
+		case tok == WHITESPACE:
+		case tok == NEWLINE && ignoreNewlines:
+		case tok == COMMENT || tok == DOCCOMMENT:
+			if tok == DOCCOMMENT {
+				p.doc = append(p.doc, docText(lit))
+			}
+			if !ignoreNewlines && strings.ContainsAny(lit, "\r\n") {
+				p.buf.tok = NEWLINE
+				return NEWLINE, lit
+			}
+		default:
+			return tok, lit
+		}
 	}
-	return
 }
 
+// docText extracts the text of a documentation comment, removing the comment
+// markers and, in block comments, any leading asterisks.
+func docText(comment string) string {
+
+	if strings.HasPrefix(comment, "///") {
+		return strings.TrimSpace(strings.TrimPrefix(comment, "///"))
+	}
+
+	comment = strings.TrimSuffix(strings.TrimPrefix(comment, "/**"), "*/")
+
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+		lines = append(lines, line)
+	}
+
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+
+}
+
+// unexpected returns a ParseError for the most recently scanned token, which
+// is not one of the expected tokens.
+func (p *parser) unexpected(expected ...token) error {
+
+	err := &ParseError{
+		Pos:     p.buf.pos,
+		Found:   p.buf.tok.describe(),
+		Literal: p.buf.lit,
+		Snippet: p.snippet(p.buf.pos),
+	}
+
+	if p.buf.tok == ILLEGAL {
+		switch lit := p.buf.lit; {
+		case strings.HasPrefix(lit, "/*"):
+			err.Found = "unterminated comment"
+		case strings.HasPrefix(lit, `"`) && !isTerminated(lit):
+			err.Found = "unterminated string literal"
+		case strings.HasPrefix(lit, `"`):
+			err.Found = "invalid string literal"
+		case lit != "" && (lit[0] == '-' || isDigit(rune(lit[0]))):
+			err.Found = "invalid number literal"
+		default:
+			err.Found = fmt.Sprintf("character %q", lit)
+		}
+	}
+
+	for _, tok := range expected {
+		err.Expected = append(err.Expected, tok.describe())
+	}
+
+	return err
+
+}
+
+// isTerminated reports whether the string literal lit ends with a closing
+// quotation mark, rather than an escaped one.
+func isTerminated(lit string) bool {
+	if len(lit) < 2 || lit[len(lit)-1] != '"' {
+		return false
+	}
+	n := 0 // the number of backslashes before the final quotation mark
+	for i := len(lit) - 2; i >= 0 && lit[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 0
+}
+
+// invalid returns a ParseError for the most recently scanned token, which
+// is of an expected kind but is nonetheless unacceptable.
+func (p *parser) invalid(format string, args ...interface{}) error {
+	return p.invalidAt(p.buf.pos, p.buf.tok, p.buf.lit, format, args...)
+}
+
+// invalidAt is like invalid, but for the token tok found earlier at pos.
+func (p *parser) invalidAt(pos Position, tok token, lit string, format string, args ...interface{}) error {
+	return &ParseError{
+		Pos:     pos,
+		Found:   tok.describe(),
+		Literal: lit,
+		Snippet: p.snippet(pos),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// snippet renders the line of the text containing pos, followed by a line
+// with a caret under pos. Tabs are preserved so that the caret lines up.
+func (p *parser) snippet(pos Position) string {
+
+	start := strings.LastIndex(p.src[:pos.Offset], "\n") + 1
+	end := strings.Index(p.src[pos.Offset:], "\n")
+	if end < 0 {
+		end = len(p.src)
+	} else {
+		end += pos.Offset
+	}
+
+	var caret strings.Builder
+	for _, ch := range p.src[start:pos.Offset] {
+		if ch == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+
+	return strings.TrimRight(p.src[start:end], "\r") + "\n" + caret.String()
+
+}
+
+// Parse parses a JSTN document into the type it declares.
 func (p *parser) Parse() (Type, error) {
-	return p.parseType()
+	doc, err := p.parseDocument(true)
+	if err != nil {
+		return Type{}, err
+	}
+	return *doc.root, nil
+}
+
+// parseDocument parses a JSTN document, which is any number of imports and
+// then named type definitions, followed by the type declaration it describes
+// unless the declaration is optional. References to named types are resolved
+// once the whole document has been read, so that a name may be used before
+// it is defined.
+func (p *parser) parseDocument(declaration bool) (*document, error) {
+
+	p.defs = make(map[string]*Type)
+	p.imports = make(map[string]imported)
+
+	for done := false; !done; {
+
+		// imports and definitions begin with a word that introduces them
+		tok, lit := p.scanIgnoreWhitespace(true)
+		doc := strings.Join(p.doc, "\n")
+
+		var err error
+		switch {
+		case tok == IDENT && lit == "import":
+			if len(p.decl) > 0 {
+				return nil, p.invalid("imports must precede definitions")
+			}
+			err = p.parseImport()
+		case tok == IDENT && lit == "type":
+			err = p.parseDefinition(doc)
+		default:
+			p.unscan()
+			done = true
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	var root *Type
+	if tok, _ := p.scanIgnoreWhitespace(true); tok != EOF || declaration {
+		p.unscan()
+
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		root = &t
+
+		// nothing may follow the type declaration
+		if tok, _ := p.scanIgnoreWhitespace(true); tok != EOF {
+			return nil, p.unexpected(EOF)
+		}
+	}
+
+	// every named type referred to must be defined
+	for _, ref := range p.refs {
+		if _, ok := p.lookup(ref.name); !ok {
+			return nil, p.invalidAt(ref.pos, IDENT, ref.name, "undefined type %s", ref.name)
+		}
+	}
+
+	for _, def := range p.defs {
+		p.resolve(def)
+	}
+	if root != nil {
+		p.resolve(root)
+	}
+
+	// a named type may refer to itself, but only from within some structure
+	for _, decl := range p.decl {
+		ref := Type{Kind: Reference, Name: decl.name, Target: p.defs[decl.name]}
+		if _, _, err := followReference(ref); err != nil {
+			return nil, p.invalidAt(decl.pos, IDENT, decl.name, "type %s is defined only in terms of itself", decl.name)
+		}
+	}
+
+	// the default value of a property must be of its type, though the type
+	// may use formats that are yet to be registered, which are ignored
+	for _, d := range p.defaults {
+		err := ValidatorOptions{anyFormat: true}.Validate(*d.t, d.t.Default)
+		if err, ok := err.(*ValidationError); ok {
+			return nil, p.invalidAt(d.pos, VALUELIT, string(d.t.Default), "invalid default: %s", strings.TrimPrefix(err.Error(), "jstn: "))
+		}
+	}
+
+	return &document{defs: p.defs, root: root}, nil
+
+}
+
+// parseImport parses the rest of an import, whose leading "import" has
+// already been consumed. The named types of the imported document are
+// referred to by qualified names, beginning with a namespace that is given
+// after the word "as" or is otherwise the base name of the imported file.
+func (p *parser) parseImport() error {
+
+	// parse the path
+	tok, lit := p.scanIgnoreWhitespace(true)
+	if tok != STRINGLIT {
+		return p.unexpected(STRINGLIT)
+	}
+	pos := p.buf.pos
+
+	var path string
+	if err := json.Unmarshal([]byte(lit), &path); err != nil {
+		return p.invalid("invalid import path %s: %s", lit, err)
+	}
+
+	// parse the namespace
+	ns := namespace(path)
+	tok, as := p.scanIgnoreWhitespace(false)
+	if tok == IDENT && as == "as" {
+		if tok, ns = p.scanIgnoreWhitespace(true); tok != IDENT {
+			return p.unexpected(IDENT)
+		}
+		if _, ok := p.imports[ns]; ok {
+			return p.invalid("namespace %s is already in use", ns)
+		}
+		tok, _ = p.scanIgnoreWhitespace(false)
+	} else if ns == "" {
+		return p.invalidAt(pos, STRINGLIT, lit, "import %s needs a namespace", lit)
+	} else if _, ok := p.imports[ns]; ok {
+		return p.invalidAt(pos, STRINGLIT, lit, "namespace %s is already in use", ns)
+	}
+
+	// the import must end with a delimiter
+	if tok != SEMICOLON && tok != NEWLINE {
+		return p.unexpected(SEMICOLON, NEWLINE)
+	}
+
+	if p.load == nil {
+		return p.invalidAt(pos, STRINGLIT, lit, "cannot import %s without a Loader", lit)
+	}
+
+	doc, err := p.load(path)
+	if err != nil {
+		if _, ok := err.(*ParseError); ok {
+			return err
+		}
+		return p.invalidAt(pos, STRINGLIT, lit, "cannot import %s: %s", lit, err)
+	}
+
+	p.imports[ns] = imported{path: path, doc: doc}
+	return nil
+
+}
+
+// namespace returns the default namespace for an import path, which is the
+// base name of the file without any extension, or "" if that isn't an
+// identifier.
+func namespace(path string) string {
+
+	name := path[strings.LastIndex(path, "/")+1:]
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+
+	if !isName(name) {
+		return ""
+	}
+	return name
+
+}
+
+// lookup finds the named type with the given name, which is qualified with a
+// namespace if it was imported.
+func (p *parser) lookup(name string) (*Type, bool) {
+
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		imp, ok := p.imports[name[:i]]
+		if !ok {
+			return nil, false
+		}
+		t, ok := imp.doc.defs[name[i+1:]]
+		return t, ok
+	}
+
+	t, ok := p.defs[name]
+	return t, ok
+
+}
+
+// parseDefinition parses the rest of a named type definition, whose leading
+// "type" has already been consumed, and documents the type with doc.
+func (p *parser) parseDefinition(doc string) error {
+
+	// parse the name
+	tok, name := p.scanIgnoreWhitespace(true)
+	if tok != IDENT {
+		return p.unexpected(IDENT)
+	}
+	if _, ok := p.defs[name]; ok {
+		return p.invalid("type %s is already defined", name)
+	}
+	p.decl = append(p.decl, reference{name: name, pos: p.buf.pos})
+
+	// parse the equals sign
+	if tok, _ := p.scanIgnoreWhitespace(true); tok != EQUALS {
+		return p.unexpected(EQUALS)
+	}
+
+	t, err := p.parseType()
+	if err != nil {
+		return err
+	}
+	t.Description = doc
+	p.defs[name] = &t
+
+	// the definition must end with a delimiter, unless it ends the text
+	if tok, _ := p.scanIgnoreWhitespace(false); tok != SEMICOLON && tok != NEWLINE && tok != EOF {
+		return p.unexpected(SEMICOLON, NEWLINE)
+	}
+
+	return nil
+
+}
+
+// resolve links every reference within t to the named type it refers to.
+// It doesn't descend into named types, which are resolved separately.
+func (p *parser) resolve(t *Type) {
+	switch t.Kind {
+	case Reference:
+		t.Target, _ = p.lookup(t.Name)
+		if i := strings.IndexByte(t.Name, '.'); i >= 0 {
+			t.Import = p.imports[t.Name[:i]].path
+		}
+	case Object:
+		for _, pt := range t.Properties {
+			p.resolve(pt)
+		}
+	case Array:
+		if t.Items != nil {
+			p.resolve(t.Items)
+		}
+	case Tuple:
+		for _, et := range t.Elements {
+			p.resolve(et)
+		}
+	case Map:
+		p.resolve(t.Values)
+	case Union:
+		for _, at := range t.Alternatives {
+			p.resolve(at)
+		}
+	}
 }
 
 func (p *parser) parseType() (Type, error) {
@@ -62,9 +508,25 @@ func (p *parser) parseType() (Type, error) {
 		return t, err
 	}
 
+	// if the next token is '|' this is a union of alternative types
+	tok, _ := p.scanIgnoreWhitespace(false)
+	if tok == PIPE {
+		first := t
+		alts := []*Type{&first}
+		for tok == PIPE {
+			alt, err := p.parseTypeDecl()
+			if err != nil {
+				return Type{}, err
+			}
+			alts = append(alts, &alt)
+			tok, _ = p.scanIgnoreWhitespace(false)
+		}
+		t = nullable(Type{Kind: Union, Alternatives: alts})
+	}
+	p.unscan()
+
 	// if the next token is '?' mark it as optional
-	tok, _ := p.scan()
-	if tok == QUESTION {
+	if tok, _ = p.scan(); tok == QUESTION {
 		t.Optional = true
 	} else {
 		p.unscan()
@@ -73,19 +535,258 @@ func (p *parser) parseType() (Type, error) {
 	return t, nil
 }
 
+// nullable replaces a union of null and a single other alternative with that
+// alternative, made nullable.
+func nullable(t Type) Type {
+
+	if len(t.Alternatives) != 2 {
+		return t
+	}
+
+	for i, alt := range t.Alternatives {
+		if other := t.Alternatives[1-i]; alt.Kind == Null && other.Kind != Null {
+			t = *other
+			t.Nullable = true
+			break
+		}
+	}
+	return t
+
+}
+
 func (p *parser) parseTypeDecl() (Type, error) {
+	t, err := p.parseConcreteType()
+	if err != nil {
+		return t, err
+	}
 
-	tok, _ := p.scanIgnoreWhitespace(true)
+	// if the next token is '(' the type has constraints
+	if tok, _ := p.scan(); tok == PARENOPEN {
+		if t.Constraints, err = p.parseConstraints(t.Kind); err != nil {
+			return Type{}, err
+		}
+	} else {
+		p.unscan()
+	}
+
+	return t, nil
+}
+
+// parseDefault parses the default value of the property type t, whose
+// preceding equals sign has already been consumed.
+func (p *parser) parseDefault(t *Type) error {
+
+	// skip whitespace and comments as scanIgnoreWhitespace would, but without
+	// scanning the value itself as tokens
+	for {
+		p.buf.pos = p.s.pos
+		ch := p.s.read()
+		if ch == eof {
+			break
+		}
+		p.s.unread()
+		if !isWhitespace(ch) && !isNewline(ch) && ch != '/' {
+			break
+		}
+		if p.buf.tok, p.buf.lit = p.s.Scan(); p.buf.tok == ILLEGAL {
+			return p.unexpected(VALUELIT)
+		}
+	}
+	p.buf.tok, p.buf.lit = p.s.scanValue(p.src)
+
+	switch p.buf.tok {
+	case VALUELIT:
+	case ILLEGAL:
+		// decode the value again for a description of what's wrong with it
+		var raw json.RawMessage
+		err := json.NewDecoder(strings.NewReader(p.src[p.buf.pos.Offset:])).Decode(&raw)
+		return p.invalid("invalid default: %s", err)
+	default:
+		return p.unexpected(VALUELIT)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(p.buf.lit)); err != nil {
+		return p.invalid("invalid default: %s", err)
+	}
+	t.Default = json.RawMessage(buf.Bytes())
+
+	p.defaults = append(p.defaults, defaulted{t: t, pos: p.buf.pos})
+	return nil
+
+}
+
+// parseFormat parses the name of a string format, whose opening angle
+// bracket has already been consumed, and the closing angle bracket.
+func (p *parser) parseFormat() (string, error) {
+
+	p.buf.pos = p.s.pos
+	p.buf.tok, p.buf.lit = p.s.scanFormatName()
+	name := p.buf.lit
+	if !isFormatName(name) {
+		if name == "" {
+			// report whatever follows instead
+			tok, _ := p.scan()
+			if tok == ANGLECLOSE {
+				return "", p.invalid("missing format name")
+			}
+			return "", p.unexpected(IDENT)
+		}
+		return "", p.invalid("invalid format name %s", name)
+	}
+
+	if tok, _ := p.scan(); tok != ANGLECLOSE {
+		return "", p.unexpected(ANGLECLOSE)
+	}
+
+	return name, nil
+
+}
+
+// parseConstraints parses a parenthesized list of constraints on a type of
+// kind k, whose opening parenthesis has already been consumed.
+func (p *parser) parseConstraints(k Kind) (*Constraints, error) {
+
+	c := &Constraints{}
+	seen := make(map[string]bool)
+
+	for {
+		tok, name := p.scanIgnoreWhitespace(true)
+		if tok != IDENT {
+			return nil, p.unexpected(IDENT)
+		}
+		if _, ok := constraintKinds[name]; !ok {
+			return nil, p.invalid("unknown constraint %s", name)
+		}
+		if !constraintApplies(name, k) {
+			return nil, p.invalid("constraint %s does not apply to %s", name, k)
+		}
+		if seen[name] {
+			return nil, p.invalid("constraint %s is repeated", name)
+		}
+		seen[name] = true
+
+		// every constraint but uniqueItems has a value
+		if name == "uniqueItems" {
+			c.UniqueItems = true
+		} else {
+			if tok, _ := p.scanIgnoreWhitespace(true); tok != EQUALS {
+				return nil, p.unexpected(EQUALS)
+			}
+			if err := p.parseConstraint(c, name); err != nil {
+				return nil, err
+			}
+		}
+
+		// constraints are separated by commas
+		if tok, _ = p.scanIgnoreWhitespace(true); tok == PARENCLOSE {
+			return c, nil
+		} else if tok != COMMA {
+			return nil, p.unexpected(COMMA, PARENCLOSE)
+		}
+	}
+
+}
+
+// parseConstraint parses the value of the named constraint into c.
+func (p *parser) parseConstraint(c *Constraints, name string) error {
+
+	tok, lit := p.scanIgnoreWhitespace(true)
+
+	switch name {
+	case "min", "max":
+		if tok != NUMBERLIT {
+			return p.unexpected(NUMBERLIT)
+		}
+		if name == "min" {
+			c.Min = json.Number(lit)
+		} else {
+			c.Max = json.Number(lit)
+		}
+
+	case "pattern":
+		if tok != STRINGLIT {
+			return p.unexpected(STRINGLIT)
+		}
+		var pattern string
+		if err := json.Unmarshal([]byte(lit), &pattern); err != nil {
+			return p.invalid("invalid pattern %s", lit)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return p.invalid("invalid pattern %q: %s", pattern, err)
+		}
+		c.Pattern = pattern
+
+	default:
+		// the lengths and numbers of items
+		if tok != NUMBERLIT {
+			return p.unexpected(NUMBERLIT)
+		}
+		n, err := strconv.Atoi(lit)
+		if err != nil || n < 0 {
+			return p.invalid("constraint %s must be a non-negative integer", name)
+		}
+		switch name {
+		case "minLength":
+			c.MinLength = &n
+		case "maxLength":
+			c.MaxLength = &n
+		case "minItems":
+			c.MinItems = &n
+		case "maxItems":
+			c.MaxItems = &n
+		}
+	}
+
+	return nil
+
+}
+
+func (p *parser) parseConcreteType() (Type, error) {
+
+	tok, lit := p.scanIgnoreWhitespace(true)
 
 	switch tok {
+	case STRINGLIT, NUMBERLIT:
+		return Type{Kind: Literal, Value: json.RawMessage(lit)}, nil
+	case IDENT:
+		// the name may be qualified by the namespace of an import
+		pos := p.buf.pos
+		if tok, _ := p.scan(); tok == PERIOD {
+			tok, name := p.scan()
+			if tok != IDENT {
+				return Type{}, p.unexpected(IDENT)
+			}
+			lit += "." + name
+		} else {
+			p.unscan()
+		}
+		p.refs = append(p.refs, reference{name: lit, pos: pos})
+		return Type{Kind: Reference, Name: lit}, nil
 	case STRING:
-		return Type{Kind: String}, nil
+		// the keyword may be followed by a format in angle brackets
+		if tok, _ := p.scan(); tok != ANGLEOPEN {
+			p.unscan()
+			return Type{Kind: String}, nil
+		}
+		format, err := p.parseFormat()
+		return Type{Kind: String, Format: format}, err
 	case NUMBER:
 		return Type{Kind: Number}, nil
+	case INTEGER:
+		return Type{Kind: Integer}, nil
 	case BOOLEAN:
 		return Type{Kind: Boolean}, nil
 	case NULL:
 		return Type{Kind: Null}, nil
+	case ANY:
+		return Type{Kind: Any}, nil
+	case OBJECT:
+		// an object with any properties
+		return Type{Kind: Object, Open: true, Properties: map[string]*Type{}}, nil
+	case ARRAY:
+		// an array with any elements
+		return Type{Kind: Array, Items: &Type{Kind: Any}}, nil
 	case SQUAREOPEN:
 		p.unscan()
 		return p.parseArray()
@@ -93,7 +794,7 @@ func (p *parser) parseTypeDecl() (Type, error) {
 		p.unscan()
 		return p.parseObject()
 	default:
-		return Type{}, fmt.Errorf("unexpected token %s", tok.String())
+		return Type{}, p.unexpected(STRING, NUMBER, INTEGER, BOOLEAN, NULL, ANY, OBJECT, ARRAY, STRINGLIT, NUMBERLIT, IDENT, SQUAREOPEN, CURLYOPEN)
 	}
 }
 
@@ -102,7 +803,7 @@ func (p *parser) parseArray() (Type, error) {
 	// parse the opening brace
 	tok, _ := p.scanIgnoreWhitespace(true)
 	if tok != SQUAREOPEN {
-		return Type{}, fmt.Errorf("unexpected token %s", tok.String())
+		return Type{}, p.unexpected(SQUAREOPEN)
 	}
 
 	// peek at the next character
@@ -118,6 +819,12 @@ func (p *parser) parseArray() (Type, error) {
 			return Type{}, err
 		}
 
+		// a comma after the first type makes this a tuple
+		if tok, _ = p.scanIgnoreWhitespace(true); tok == COMMA {
+			return p.parseTuple(t)
+		}
+		p.unscan()
+
 		childType = &t
 
 	}
@@ -125,12 +832,49 @@ func (p *parser) parseArray() (Type, error) {
 	// parse the closing brace
 	tok, _ = p.scanIgnoreWhitespace(true)
 	if tok != SQUARECLOSE {
-		return Type{}, fmt.Errorf("unexpected token %s", tok.String())
+		return Type{}, p.unexpected(COMMA, SQUARECLOSE)
 	}
 
 	return Type{Kind: Array, Items: childType}, nil
 }
 
+// parseTuple parses the remaining elements of a tuple, whose opening bracket,
+// first element and first comma have already been consumed. A comma may
+// follow the last element, as it must for a tuple of just one element.
+func (p *parser) parseTuple(first Type) (Type, error) {
+
+	elements := []*Type{&first}
+
+	for {
+
+		// peek for the closing brace after a trailing comma
+		tok, _ := p.scanIgnoreWhitespace(true)
+		p.unscan()
+		if tok == SQUARECLOSE {
+			break
+		}
+
+		t, err := p.parseType()
+		if err != nil {
+			return Type{}, err
+		}
+		elements = append(elements, &t)
+
+		if tok, _ = p.scanIgnoreWhitespace(true); tok == SQUARECLOSE {
+			p.unscan()
+			break
+		} else if tok != COMMA {
+			return Type{}, p.unexpected(COMMA, SQUARECLOSE)
+		}
+
+	}
+
+	// consume the closing brace
+	p.scanIgnoreWhitespace(true)
+
+	return Type{Kind: Tuple, Elements: elements}, nil
+}
+
 func (p *parser) parseObject() (Type, error) {
 
 	var tok token
@@ -139,10 +883,12 @@ func (p *parser) parseObject() (Type, error) {
 	// parse the opening brace
 	tok, _ = p.scanIgnoreWhitespace(true)
 	if tok != CURLYOPEN {
-		return Type{}, fmt.Errorf("unexpected token %s", tok.String())
+		return Type{}, p.unexpected(CURLYOPEN)
 	}
 
 	props := make(map[string]*Type)
+	var order []string
+	var open bool
 
 	for {
 
@@ -154,15 +900,50 @@ func (p *parser) parseObject() (Type, error) {
 			break
 		}
 
-		// parse the property name
-		if tok != IDENT {
-			log.Println("failing here")
-			return Type{}, fmt.Errorf("unexpected token %s for %s", tok.String(), IDENT.String())
+		// an index signature in place of the first member makes this a map
+		if tok == SQUAREOPEN && len(props) == 0 {
+			p.unscan()
+			return p.parseMap()
 		}
 
-		// parse the colon
-		if tok, _ := p.scanIgnoreWhitespace(true); tok != COLON {
-			return Type{}, fmt.Errorf("unexpected token %s for %s", tok.String(), COLON.String())
+		// an ellipsis as the last member makes the object open
+		if tok == ELLIPSIS {
+			if tok, _ = p.scanIgnoreWhitespace(true); tok == SEMICOLON {
+				tok, _ = p.scanIgnoreWhitespace(true)
+			}
+			if tok != CURLYCLOSE {
+				return Type{}, p.unexpected(CURLYCLOSE)
+			}
+			p.unscan()
+			open = true
+			break
+		}
+
+		// parse the property name, which may also be a known identifier or,
+		// for names that aren't identifiers, a string literal
+		if tok == STRINGLIT {
+			var name string
+			if err := json.Unmarshal([]byte(lit), &name); err != nil {
+				return Type{}, p.invalid("invalid property name %s", lit)
+			}
+			lit = name
+		} else if tok != IDENT && !tok.isKeyword() {
+			return Type{}, p.unexpected(IDENT, STRINGLIT, ELLIPSIS, CURLYCLOSE)
+		}
+		doc := strings.Join(p.doc, "\n")
+
+		// parse the colon, which may be preceded by a '?' marking the
+		// property as one that may be omitted
+		omittable := false
+		if tok, _ = p.scanIgnoreWhitespace(true); tok == QUESTION {
+			omittable = true
+			tok, _ = p.scanIgnoreWhitespace(true)
+		}
+		if tok != COLON {
+			if omittable {
+				return Type{}, p.unexpected(COLON)
+			}
+			return Type{}, p.unexpected(QUESTION, COLON)
 		}
 
 		// parse the object type
@@ -170,13 +951,31 @@ func (p *parser) parseObject() (Type, error) {
 		if err != nil {
 			return Type{}, err
 		}
+		t.Description = doc
+		t.Omittable = omittable
 
-		props[lit] = &t // save this property type
+		// an optional or omittable property may have a default value
+		if tok, _ = p.scanIgnoreWhitespace(false); tok == EQUALS {
+			if !t.Optional && !t.Omittable {
+				return Type{}, p.invalid("only a property that may be omitted can have a default")
+			}
+			if err := p.parseDefault(&t); err != nil {
+				return Type{}, err
+			}
+		} else {
+			p.unscan()
+		}
+
+		// save this property type, noting the order of declaration
+		if _, ok := props[lit]; !ok {
+			order = append(order, lit)
+		}
+		props[lit] = &t
 
 		// Every property pair must finish with a delimiter token, which can be
 		// either a CURLYCLOSE (indicating the end of the object), a SEMICOLON,
 		// or a NEWLINE.
-		if tok, lit = p.scanIgnoreWhitespace(false); tok == CURLYCLOSE {
+		if tok, _ = p.scanIgnoreWhitespace(false); tok == CURLYCLOSE {
 
 			// The SEMICOLON acts as a delimiter because it marks
 			// the end of the entire object. There won't be any
@@ -189,7 +988,7 @@ func (p *parser) parseObject() (Type, error) {
 			// If we didn't find a SEMICOLON, the only other valid
 			// token is a NEWLINE. But we didn't find that either, so
 			// we've got an error here.
-			return Type{}, fmt.Errorf("unexpected token %s (%q) for [%s or %s]", tok.String(), lit, SEMICOLON.String(), NEWLINE.String())
+			return Type{}, p.unexpected(SEMICOLON, NEWLINE, CURLYCLOSE)
 
 		}
 
@@ -198,8 +997,60 @@ func (p *parser) parseObject() (Type, error) {
 	// parse the closing brace
 	tok, _ = p.scanIgnoreWhitespace(true)
 	if tok != CURLYCLOSE {
-		return Type{}, fmt.Errorf("unexpected token %s", tok.String())
+		return Type{}, p.unexpected(CURLYCLOSE)
+	}
+
+	return Type{Kind: Object, Properties: props, Order: order, Open: open}, nil
+}
+
+// parseMap parses the rest of a map, whose opening brace has already been
+// consumed. A map has a single index signature, in which the key type is
+// either string or a string literal holding a regular expression that every
+// key must match.
+func (p *parser) parseMap() (Type, error) {
+
+	// parse the opening bracket of the index signature
+	if tok, _ := p.scanIgnoreWhitespace(true); tok != SQUAREOPEN {
+		return Type{}, p.unexpected(SQUAREOPEN)
+	}
+
+	// parse the key type
+	var pattern string
+	switch tok, lit := p.scanIgnoreWhitespace(true); tok {
+	case STRING:
+	case STRINGLIT:
+		if err := json.Unmarshal([]byte(lit), &pattern); err != nil {
+			return Type{}, p.invalid("invalid key pattern %s: %s", lit, err)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return Type{}, p.invalid("invalid key pattern %s: %s", lit, err)
+		}
+	default:
+		return Type{}, p.unexpected(STRING, STRINGLIT)
+	}
+
+	// parse the closing bracket and the colon
+	if tok, _ := p.scanIgnoreWhitespace(true); tok != SQUARECLOSE {
+		return Type{}, p.unexpected(SQUARECLOSE)
+	}
+	if tok, _ := p.scanIgnoreWhitespace(true); tok != COLON {
+		return Type{}, p.unexpected(COLON)
+	}
+
+	// parse the value type
+	t, err := p.parseType()
+	if err != nil {
+		return Type{}, err
+	}
+
+	// parse the closing brace, which may follow a delimiter
+	tok, _ := p.scanIgnoreWhitespace(true)
+	if tok == SEMICOLON {
+		tok, _ = p.scanIgnoreWhitespace(true)
+	}
+	if tok != CURLYCLOSE {
+		return Type{}, p.unexpected(CURLYCLOSE)
 	}
 
-	return Type{Kind: Object, Properties: props}, nil
+	return Type{Kind: Map, Values: &t, KeyPattern: pattern}, nil
 }
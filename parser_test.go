@@ -1,6 +1,7 @@
 package jstn
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
@@ -64,7 +65,7 @@ func TestParser(t *testing.T) {
 			Schema: `{key: string}`,
 			Parsed: Type{Kind: Object, Properties: map[string]*Type{
 				"key": &Type{Kind: String},
-			}},
+			}, Order: []string{"key"}},
 		},
 		{
 			Schema: `{}`,
@@ -75,7 +76,7 @@ func TestParser(t *testing.T) {
 			Parsed: Type{Kind: Object, Properties: map[string]*Type{
 				"name": &Type{Kind: String},
 				"age":  &Type{Kind: Number, Optional: true},
-			}},
+			}, Order: []string{"name", "age"}},
 		},
 		{
 			Schema: `{
@@ -85,7 +86,7 @@ func TestParser(t *testing.T) {
 			Parsed: Type{Kind: Object, Properties: map[string]*Type{
 				"name": &Type{Kind: String},
 				"age":  &Type{Kind: Number, Optional: true},
-			}},
+			}, Order: []string{"name", "age"}},
 		},
 		{
 			Schema: `{
@@ -95,7 +96,7 @@ func TestParser(t *testing.T) {
 			Parsed: Type{Kind: Object, Properties: map[string]*Type{
 				"name": &Type{Kind: String},
 				"age":  &Type{Kind: Number, Optional: true},
-			}},
+			}, Order: []string{"name", "age"}},
 		},
 		{
 			Schema: `{author:string;works:[{
@@ -108,9 +109,335 @@ func TestParser(t *testing.T) {
 					"title":   &Type{Kind: String},
 					"year":    &Type{Kind: Number, Optional: true},
 					"classic": &Type{Kind: Boolean},
-				}}},
+				}, Order: []string{"title", "year", "classic"}}},
+			}, Order: []string{"author", "works"}},
+		},
+		{
+			// Comments are ignored, and a line comment doesn't prevent the
+			// newline that follows it from acting as a delimiter.
+			Schema: `// a person
+{
+	name: string // the full name
+	/* age in years */ age: number? /* may be
+	unknown */ id: number
+	tags: [string /* lowercase */]
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"name": &Type{Kind: String},
+				"age":  &Type{Kind: Number, Optional: true},
+				"id":   &Type{Kind: Number},
+				"tags": &Type{Kind: Array, Items: &Type{Kind: String}},
+			}, Order: []string{"name", "age", "id", "tags"}},
+		},
+		{
+			Schema: `string | number`,
+			Parsed: Type{Kind: Union, Alternatives: []*Type{
+				&Type{Kind: String},
+				&Type{Kind: Number},
 			}},
 		},
+		{
+			// A trailing '?' makes the whole union optional.
+			Schema: `[string|{id: number}|[boolean]?]`,
+			Parsed: Type{Kind: Array, Items: &Type{Kind: Union, Optional: true, Alternatives: []*Type{
+				&Type{Kind: String},
+				&Type{Kind: Object, Properties: map[string]*Type{
+					"id": &Type{Kind: Number},
+				}, Order: []string{"id"}},
+				&Type{Kind: Array, Items: &Type{Kind: Boolean}},
+			}}},
+		},
+		{
+			// An alternative may follow a line break after the separator.
+			Schema: `{
+	id: string |
+		number
+	name: string
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"id": &Type{Kind: Union, Alternatives: []*Type{
+					&Type{Kind: String},
+					&Type{Kind: Number},
+				}},
+				"name": &Type{Kind: String},
+			}, Order: []string{"id", "name"}},
+		},
+		{
+			// Documentation comments describe the property that follows.
+			Schema: `{
+	/// The ISBN-13 of the work.
+	isbn: string // not a doc comment
+	/// The title of the work,
+	/// in its original language.
+	title: string
+	/**
+	 * The year of publication.
+	 */
+	year: number?
+	/// Ignored, as it's not followed by a property.
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"isbn":  &Type{Kind: String, Description: "The ISBN-13 of the work."},
+				"title": &Type{Kind: String, Description: "The title of the work,\nin its original language."},
+				"year":  &Type{Kind: Number, Optional: true, Description: "The year of publication."},
+			}, Order: []string{"isbn", "title", "year"}},
+		},
+		{
+			Schema: `{
+	status: "active" | "suspended" | "deleted"
+	version: 2
+	ratio: -1.5e3?
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"status": &Type{Kind: Union, Alternatives: []*Type{
+					&Type{Kind: Literal, Value: json.RawMessage(`"active"`)},
+					&Type{Kind: Literal, Value: json.RawMessage(`"suspended"`)},
+					&Type{Kind: Literal, Value: json.RawMessage(`"deleted"`)},
+				}},
+				"version": &Type{Kind: Literal, Value: json.RawMessage(`2`)},
+				"ratio":   &Type{Kind: Literal, Optional: true, Value: json.RawMessage(`-1.5e3`)},
+			}, Order: []string{"status", "version", "ratio"}},
+		},
+		{
+			Schema: `{count: integer; ids: [integer?]}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"count": &Type{Kind: Integer},
+				"ids":   &Type{Kind: Array, Items: &Type{Kind: Integer, Optional: true}},
+			}, Order: []string{"count", "ids"}},
+		},
+		{
+			Schema: `[number, number]`,
+			Parsed: Type{Kind: Tuple, Elements: []*Type{
+				&Type{Kind: Number},
+				&Type{Kind: Number},
+			}},
+		},
+		{
+			// A trailing comma is allowed, and makes a one-element tuple.
+			Schema: `{
+	point: [
+		string | number,
+		[integer],
+		boolean?,
+	]?
+	single: [string,]
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"point": &Type{Kind: Tuple, Optional: true, Elements: []*Type{
+					&Type{Kind: Union, Alternatives: []*Type{
+						&Type{Kind: String},
+						&Type{Kind: Number},
+					}},
+					&Type{Kind: Array, Items: &Type{Kind: Integer}},
+					&Type{Kind: Boolean, Optional: true},
+				}},
+				"single": &Type{Kind: Tuple, Elements: []*Type{
+					&Type{Kind: String},
+				}},
+			}, Order: []string{"point", "single"}},
+		},
+		{
+			Schema: `{
+	scores: {[string]: number}
+	labels: {
+		["^[a-z]+(-[a-z]+)*$"]: {text: string}?;
+	}
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"scores": &Type{Kind: Map, Values: &Type{Kind: Number}},
+				"labels": &Type{Kind: Map, KeyPattern: "^[a-z]+(-[a-z]+)*$", Values: &Type{Kind: Object, Optional: true, Properties: map[string]*Type{
+					"text": &Type{Kind: String},
+				}, Order: []string{"text"}}},
+			}, Order: []string{"scores", "labels"}},
+		},
+		{
+			Schema: `{
+	id: string
+	extra: {...}
+	...
+}`,
+			Parsed: Type{Kind: Object, Open: true, Properties: map[string]*Type{
+				"id":    &Type{Kind: String},
+				"extra": &Type{Kind: Object, Open: true, Properties: map[string]*Type{}},
+			}, Order: []string{"id", "extra"}},
+		},
+		{
+			Schema: `{id: string; ...;}?`,
+			Parsed: Type{Kind: Object, Optional: true, Open: true, Properties: map[string]*Type{
+				"id": &Type{Kind: String},
+			}, Order: []string{"id"}},
+		},
+		{
+			// A named type may be used before it is defined.
+			Schema: `type Person = {name: string; home: Address?}
+
+/// A postal address.
+type Address = {
+	street: string
+	city: string
+}; type ID = string | integer
+
+{id: ID; people: [Person]}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"id": &Type{Kind: Reference, Name: "ID", Target: &Type{Kind: Union, Alternatives: []*Type{
+					&Type{Kind: String},
+					&Type{Kind: Integer},
+				}}},
+				"people": &Type{Kind: Array, Items: &Type{Kind: Reference, Name: "Person", Target: &Type{Kind: Object, Properties: map[string]*Type{
+					"name": &Type{Kind: String},
+					"home": &Type{Kind: Reference, Name: "Address", Optional: true, Target: &Type{Kind: Object, Properties: map[string]*Type{
+						"street": &Type{Kind: String},
+						"city":   &Type{Kind: String},
+					}, Order: []string{"street", "city"}, Description: "A postal address."}},
+				}, Order: []string{"name", "home"}}}},
+			}, Order: []string{"id", "people"}},
+		},
+		{
+			// The word "type" only introduces a definition at the top level.
+			Schema: `{type: string}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"type": &Type{Kind: String},
+			}, Order: []string{"type"}},
+		},
+		{
+			// A '?' after the name lets a property be omitted, while a union
+			// with null lets a value be null.
+			Schema: `type ID = string
+{
+	nickname?: string
+	manager: {id: number} | null
+	parent: null | ID?
+	tags?: [string | null]
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"nickname": &Type{Kind: String, Omittable: true},
+				"manager": &Type{Kind: Object, Nullable: true, Properties: map[string]*Type{
+					"id": &Type{Kind: Number},
+				}, Order: []string{"id"}},
+				"parent": &Type{Kind: Reference, Name: "ID", Nullable: true, Optional: true, Target: &Type{Kind: String}},
+				"tags":   &Type{Kind: Array, Omittable: true, Items: &Type{Kind: String, Nullable: true}},
+			}, Order: []string{"nickname", "manager", "parent", "tags"}},
+		},
+		{
+			// Known identifiers may also name properties.
+			Schema: `{
+	metadata: any
+	object: object
+	array: array?
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"metadata": &Type{Kind: Any},
+				"object":   &Type{Kind: Object, Open: true, Properties: map[string]*Type{}},
+				"array":    &Type{Kind: Array, Optional: true, Items: &Type{Kind: Any}},
+			}, Order: []string{"metadata", "object", "array"}},
+		},
+		{
+			// Only the lowercase words are keywords, so others can name types.
+			Schema: `type Object = {a: string}; type Any = Object | Integer
+type Integer = integer
+{any: Any; list: [Object]}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"any": &Type{Kind: Reference, Name: "Any", Target: &Type{Kind: Union, Alternatives: []*Type{
+					&Type{Kind: Reference, Name: "Object", Target: &Type{Kind: Object, Properties: map[string]*Type{
+						"a": &Type{Kind: String},
+					}, Order: []string{"a"}}},
+					&Type{Kind: Reference, Name: "Integer", Target: &Type{Kind: Integer}},
+				}}},
+				"list": &Type{Kind: Array, Items: &Type{Kind: Reference, Name: "Object", Target: &Type{Kind: Object, Properties: map[string]*Type{
+					"a": &Type{Kind: String},
+				}, Order: []string{"a"}}}},
+			}, Order: []string{"any", "list"}},
+		},
+		{
+			// Names that aren't identifiers are quoted like JSON strings.
+			Schema: `{
+	"content-type": string
+	"@id"?: string; "$ref": string
+	"x.y": number
+	"caf\u00e9": "na\u00efve" | "naïve"
+	"say \"hi\"\n": boolean
+	"": null
+	"plain": integer
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"content-type": &Type{Kind: String},
+				"@id":          &Type{Kind: String, Omittable: true},
+				"$ref":         &Type{Kind: String},
+				"x.y":          &Type{Kind: Number},
+				"café": &Type{Kind: Union, Alternatives: []*Type{
+					&Type{Kind: Literal, Value: json.RawMessage(`"na\u00efve"`)},
+					&Type{Kind: Literal, Value: json.RawMessage(`"naïve"`)},
+				}},
+				"say \"hi\"\n": &Type{Kind: Boolean},
+				"":             &Type{Kind: Null},
+				"plain":        &Type{Kind: Integer},
+			}, Order: []string{"content-type", "@id", "$ref", "x.y", "café", "say \"hi\"\n", "", "plain"}},
+		},
+		{
+			Schema: `{
+	age: integer(min=0, max=150)
+	ratio: number( min = -1.5e0 )?
+	name: string(minLength=1,maxLength=64,pattern="^[a-z\\\\]+$") | null
+	tags: [string](minItems=1, uniqueItems)
+	all: array(maxItems=0)
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"age":   &Type{Kind: Integer, Constraints: &Constraints{Min: "0", Max: "150"}},
+				"ratio": &Type{Kind: Number, Optional: true, Constraints: &Constraints{Min: "-1.5e0"}},
+				"name":  &Type{Kind: String, Nullable: true, Constraints: &Constraints{MinLength: intPtr(1), MaxLength: intPtr(64), Pattern: `^[a-z\\]+$`}},
+				"tags":  &Type{Kind: Array, Items: &Type{Kind: String}, Constraints: &Constraints{MinItems: intPtr(1), UniqueItems: true}},
+				"all":   &Type{Kind: Array, Items: &Type{Kind: Any}, Constraints: &Constraints{MaxItems: intPtr(0)}},
+			}, Order: []string{"age", "ratio", "name", "tags", "all"}},
+		},
+		{
+			Schema: `{
+	id: string<uuid>
+	created: string<date-time>?
+	sku: string<sku_2>(maxLength=12) | null
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"id":      &Type{Kind: String, Format: "uuid"},
+				"created": &Type{Kind: String, Format: "date-time", Optional: true},
+				"sku":     &Type{Kind: String, Format: "sku_2", Nullable: true, Constraints: &Constraints{MaxLength: intPtr(12)}},
+			}, Order: []string{"id", "created", "sku"}},
+		},
+		{
+			Schema: `{
+	retries: number? = 3
+	name?: string | null = "default"
+	tags?: [string] = [
+		"a", "b"
+	]
+	limits?: {max: integer?} = {"max": 10}; mode?: string = "fast"
+	level?: integer = /* the default */ 3
+	depth?: integer = // the default
+		2
+}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"retries": &Type{Kind: Number, Optional: true, Default: json.RawMessage(`3`)},
+				"name":    &Type{Kind: String, Omittable: true, Nullable: true, Default: json.RawMessage(`"default"`)},
+				"tags":    &Type{Kind: Array, Omittable: true, Items: &Type{Kind: String}, Default: json.RawMessage(`["a","b"]`)},
+				"limits": &Type{Kind: Object, Omittable: true, Properties: map[string]*Type{
+					"max": &Type{Kind: Integer, Optional: true},
+				}, Order: []string{"max"}, Default: json.RawMessage(`{"max":10}`)},
+				"mode":  &Type{Kind: String, Omittable: true, Default: json.RawMessage(`"fast"`)},
+				"level": &Type{Kind: Integer, Omittable: true, Default: json.RawMessage(`3`)},
+				"depth": &Type{Kind: Integer, Omittable: true, Default: json.RawMessage(`2`)},
+			}, Order: []string{"retries", "name", "tags", "limits", "mode", "level", "depth"}},
+		},
+		{
+			Schema: `{a?: string<nope> = "x"}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"a": &Type{Kind: String, Format: "nope", Omittable: true, Default: json.RawMessage(`"x"`)},
+			}, Order: []string{"a"}},
+		},
+		{
+			Schema: `{a:string/**/;b:number}`,
+			Parsed: Type{Kind: Object, Properties: map[string]*Type{
+				"a": &Type{Kind: String},
+				"b": &Type{Kind: Number},
+			}, Order: []string{"a", "b"}},
+		},
 	}
 
 	for i, c := range cases {
@@ -127,3 +454,451 @@ func TestParser(t *testing.T) {
 	}
 
 }
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestParser_Recursive(t *testing.T) {
+
+	schema := MustParse(`type Node = {
+	name: string
+	children: [Node]
+	parent: Node?
+}
+Node`)
+
+	node := schema.Target
+	if schema.Kind != Reference || node == nil || node.Kind != Object {
+		t.Fatalf("unexpected parse results: %# v", schema)
+	}
+
+	// the references within the type lead back to it
+	if target := node.Properties["children"].Items.Target; target != node {
+		t.Errorf("unexpected target of children: %p rather than %p", target, node)
+	}
+	if target := node.Properties["parent"].Target; target != node {
+		t.Errorf("unexpected target of parent: %p rather than %p", target, node)
+	}
+
+	// mutually recursive types work likewise
+	schema = MustParse("type A = {b: B?}; type B = [A]\nA")
+	a := schema.Target
+	if target := a.Properties["b"].Target.Items.Target; target != a {
+		t.Errorf("unexpected target of b's items: %p rather than %p", target, a)
+	}
+
+}
+
+func TestParseError(t *testing.T) {
+
+	cases := []struct {
+		Schema string
+		Error  ParseError
+	}{
+		{
+			Schema: `{
+	name: string
+	age number
+}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 21, Line: 3, Column: 6},
+				Found:    `"number"`,
+				Literal:  "number",
+				Expected: []string{`"?"`, `":"`},
+				Snippet:  "\tage number\n\t    ^",
+			},
+		},
+		{
+			Schema: `[string`,
+			Error: ParseError{
+				Pos:      Position{Offset: 7, Line: 1, Column: 8},
+				Found:    "end of input",
+				Expected: []string{`","`, `"]"`},
+				Snippet:  "[string\n       ^",
+			},
+		},
+		{
+			Schema: `[string, number boolean]`,
+			Error: ParseError{
+				Pos:      Position{Offset: 16, Line: 1, Column: 17},
+				Found:    `"boolean"`,
+				Literal:  "boolean",
+				Expected: []string{`","`, `"]"`},
+				Snippet:  "[string, number boolean]\n                ^",
+			},
+		},
+		{
+			Schema: `{["[a-z"]: number}`,
+			Error: ParseError{
+				Pos:     Position{Offset: 2, Line: 1, Column: 3},
+				Found:   "string literal",
+				Literal: `"[a-z"`,
+				Snippet: "{[\"[a-z\"]: number}\n  ^",
+				Message: "invalid key pattern \"[a-z\": error parsing regexp: missing closing ]: `[a-z`",
+			},
+		},
+		{
+			Schema: `{[number]: string}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 2, Line: 1, Column: 3},
+				Found:    `"number"`,
+				Literal:  "number",
+				Expected: []string{`"string"`, "string literal"},
+				Snippet:  "{[number]: string}\n  ^",
+			},
+		},
+		{
+			Schema: `{..., id: string}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 4, Line: 1, Column: 5},
+				Found:    `","`,
+				Literal:  ",",
+				Expected: []string{`"}"`},
+				Snippet:  "{..., id: string}\n    ^",
+			},
+		},
+		{
+			Schema: `{.. id: string}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 1, Line: 1, Column: 2},
+				Found:    `character ".."`,
+				Literal:  "..",
+				Expected: []string{"identifier", "string literal", `"..."`, `"}"`},
+				Snippet:  "{.. id: string}\n ^",
+			},
+		},
+		{
+			Schema: "type A = string\n{a: A; b: B}",
+			Error: ParseError{
+				Pos:     Position{Offset: 26, Line: 2, Column: 11},
+				Found:   "identifier",
+				Literal: "B",
+				Snippet: "{a: A; b: B}\n          ^",
+				Message: "undefined type B",
+			},
+		},
+		{
+			Schema: "type A = string\ntype A = number\nA",
+			Error: ParseError{
+				Pos:     Position{Offset: 21, Line: 2, Column: 6},
+				Found:   "identifier",
+				Literal: "A",
+				Snippet: "type A = number\n     ^",
+				Message: "type A is already defined",
+			},
+		},
+		{
+			Schema: "type A = string A",
+			Error: ParseError{
+				Pos:      Position{Offset: 16, Line: 1, Column: 17},
+				Found:    "identifier",
+				Literal:  "A",
+				Expected: []string{`";"`, "newline"},
+				Snippet:  "type A = string A\n                ^",
+			},
+		},
+		{
+			Schema: "{a: string}\n{b: string}",
+			Error: ParseError{
+				Pos:      Position{Offset: 12, Line: 2, Column: 1},
+				Found:    `"{"`,
+				Literal:  "{",
+				Expected: []string{"end of input"},
+				Snippet:  "{b: string}\n^",
+			},
+		},
+		{
+			Schema: "type A = B\ntype B = A?\nA",
+			Error: ParseError{
+				Pos:     Position{Offset: 5, Line: 1, Column: 6},
+				Found:   "identifier",
+				Literal: "A",
+				Snippet: "type A = B\n     ^",
+				Message: "type A is defined only in terms of itself",
+			},
+		},
+		{
+			Schema: `{a: string %}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 11, Line: 1, Column: 12},
+				Found:    `character "%"`,
+				Literal:  "%",
+				Expected: []string{`";"`, "newline", `"}"`},
+				Snippet:  "{a: string %}\n           ^",
+			},
+		},
+		{
+			Schema: `{a: string /* oops}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 11, Line: 1, Column: 12},
+				Found:    "unterminated comment",
+				Literal:  "/* oops}",
+				Expected: []string{`";"`, "newline", `"}"`},
+				Snippet:  "{a: string /* oops}\n           ^",
+			},
+		},
+		{
+			Schema: `{a: "x}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 4, Line: 1, Column: 5},
+				Found:    "unterminated string literal",
+				Literal:  `"x}`,
+				Expected: []string{`"string"`, `"number"`, `"integer"`, `"boolean"`, `"null"`, `"any"`, `"object"`, `"array"`, "string literal", "number literal", "identifier", `"["`, `"{"`},
+				Snippet:  "{a: \"x}\n    ^",
+			},
+		},
+		{
+			Schema: `{a: "x\"}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 4, Line: 1, Column: 5},
+				Found:    "unterminated string literal",
+				Literal:  `"x\"}`,
+				Expected: []string{`"string"`, `"number"`, `"integer"`, `"boolean"`, `"null"`, `"any"`, `"object"`, `"array"`, "string literal", "number literal", "identifier", `"["`, `"{"`},
+				Snippet:  "{a: \"x\\\"}\n    ^",
+			},
+		},
+		{
+			Schema: `{a: "\q"}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 4, Line: 1, Column: 5},
+				Found:    "invalid string literal",
+				Literal:  `"\q"`,
+				Expected: []string{`"string"`, `"number"`, `"integer"`, `"boolean"`, `"null"`, `"any"`, `"object"`, `"array"`, "string literal", "number literal", "identifier", `"["`, `"{"`},
+				Snippet:  "{a: \"\\q\"}\n    ^",
+			},
+		},
+		{
+			Schema: `{a: 1.}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 4, Line: 1, Column: 5},
+				Found:    "invalid number literal",
+				Literal:  "1.",
+				Expected: []string{`"string"`, `"number"`, `"integer"`, `"boolean"`, `"null"`, `"any"`, `"object"`, `"array"`, "string literal", "number literal", "identifier", `"["`, `"{"`},
+				Snippet:  "{a: 1.}\n    ^",
+			},
+		},
+		{
+			Schema: `{a: string / b: number}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 11, Line: 1, Column: 12},
+				Found:    `character "/"`,
+				Literal:  "/",
+				Expected: []string{`";"`, "newline", `"}"`},
+				Snippet:  "{a: string / b: number}\n           ^",
+			},
+		},
+		{
+			Schema: `{a: lib.}`,
+			Error: ParseError{
+				Pos:      Position{Offset: 8, Line: 1, Column: 9},
+				Found:    `"}"`,
+				Literal:  "}",
+				Expected: []string{"identifier"},
+				Snippet:  "{a: lib.}\n        ^",
+			},
+		},
+		{
+			Schema: `string<>`,
+			Error: ParseError{
+				Pos:     Position{Offset: 7, Line: 1, Column: 8},
+				Found:   `">"`,
+				Literal: ">",
+				Snippet: "string<>\n       ^",
+				Message: "missing format name",
+			},
+		},
+		{
+			Schema: `string<date time>`,
+			Error: ParseError{
+				Pos:      Position{Offset: 11, Line: 1, Column: 12},
+				Found:    "whitespace",
+				Literal:  " ",
+				Expected: []string{`">"`},
+				Snippet:  "string<date time>\n           ^",
+			},
+		},
+		{
+			Schema: `string<2fa>`,
+			Error: ParseError{
+				Pos:     Position{Offset: 7, Line: 1, Column: 8},
+				Found:   "identifier",
+				Literal: "2fa",
+				Snippet: "string<2fa>\n       ^",
+				Message: "invalid format name 2fa",
+			},
+		},
+		{
+			Schema: `string(minimum=1)`,
+			Error: ParseError{
+				Pos:     Position{Offset: 7, Line: 1, Column: 8},
+				Found:   "identifier",
+				Literal: "minimum",
+				Snippet: "string(minimum=1)\n       ^",
+				Message: "unknown constraint minimum",
+			},
+		},
+		{
+			Schema: `{age: number(min=0, minLength=1)}`,
+			Error: ParseError{
+				Pos:     Position{Offset: 20, Line: 1, Column: 21},
+				Found:   "identifier",
+				Literal: "minLength",
+				Snippet: "{age: number(min=0, minLength=1)}\n                    ^",
+				Message: "constraint minLength does not apply to number",
+			},
+		},
+		{
+			Schema: `[string](minItems=1, minItems=2)`,
+			Error: ParseError{
+				Pos:     Position{Offset: 21, Line: 1, Column: 22},
+				Found:   "identifier",
+				Literal: "minItems",
+				Snippet: "[string](minItems=1, minItems=2)\n                     ^",
+				Message: "constraint minItems is repeated",
+			},
+		},
+		{
+			Schema: `string(maxLength=1.5)`,
+			Error: ParseError{
+				Pos:     Position{Offset: 17, Line: 1, Column: 18},
+				Found:   "number literal",
+				Literal: "1.5",
+				Snippet: "string(maxLength=1.5)\n                 ^",
+				Message: "constraint maxLength must be a non-negative integer",
+			},
+		},
+		{
+			Schema: `string(pattern=1)`,
+			Error: ParseError{
+				Pos:      Position{Offset: 15, Line: 1, Column: 16},
+				Found:    "number literal",
+				Literal:  "1",
+				Expected: []string{"string literal"},
+				Snippet:  "string(pattern=1)\n               ^",
+			},
+		},
+		{
+			Schema: `number(min=1 max=2)`,
+			Error: ParseError{
+				Pos:      Position{Offset: 13, Line: 1, Column: 14},
+				Found:    "identifier",
+				Literal:  "max",
+				Expected: []string{`","`, `")"`},
+				Snippet:  "number(min=1 max=2)\n             ^",
+			},
+		},
+		{
+			Schema: `{retries: number = 3}`,
+			Error: ParseError{
+				Pos:     Position{Offset: 17, Line: 1, Column: 18},
+				Found:   `"="`,
+				Literal: "=",
+				Snippet: "{retries: number = 3}\n                 ^",
+				Message: "only a property that may be omitted can have a default",
+			},
+		},
+		{
+			Schema: `{tags?: [string] = ["a",]}`,
+			Error: ParseError{
+				Pos:     Position{Offset: 19, Line: 1, Column: 20},
+				Found:   "illegal",
+				Literal: `["a",]}`,
+				Snippet: "{tags?: [string] = [\"a\",]}\n                   ^",
+				Message: "invalid default: invalid character ']' looking for beginning of value",
+			},
+		},
+		{
+			Schema: `{retries?: number = }`,
+			Error: ParseError{
+				Pos:     Position{Offset: 20, Line: 1, Column: 21},
+				Found:   "illegal",
+				Literal: "}",
+				Snippet: "{retries?: number = }\n                    ^",
+				Message: "invalid default: invalid character '}' looking for beginning of value",
+			},
+		},
+		{
+			Schema: "type Retries = integer(min=0)\n{retries?: Retries = -1}",
+			Error: ParseError{
+				Pos:     Position{Offset: 51, Line: 2, Column: 22},
+				Found:   "JSON value",
+				Literal: "-1",
+				Snippet: "{retries?: Retries = -1}\n                     ^",
+				Message: "invalid default: expected at least 0 but got -1",
+			},
+		},
+		{
+			Schema: `{retries?: number = /* 3 }`,
+			Error: ParseError{
+				Pos:      Position{Offset: 20, Line: 1, Column: 21},
+				Found:    "unterminated comment",
+				Literal:  "/* 3 }",
+				Snippet:  "{retries?: number = /* 3 }\n                    ^",
+				Expected: []string{"JSON value"},
+			},
+		},
+		{
+			Schema: `{a?: string<nope> = 1}`,
+			Error: ParseError{
+				Pos:     Position{Offset: 20, Line: 1, Column: 21},
+				Found:   "JSON value",
+				Literal: "1",
+				Snippet: "{a?: string<nope> = 1}\n                    ^",
+				Message: "invalid default: expected string but got number",
+			},
+		},
+		{
+			Schema: "type A = string\nimport \"lib.jstn\"\nA",
+			Error: ParseError{
+				Pos:     Position{Offset: 16, Line: 2, Column: 1},
+				Found:   "identifier",
+				Literal: "import",
+				Snippet: "import \"lib.jstn\"\n^",
+				Message: "imports must precede definitions",
+			},
+		},
+	}
+
+	for i, c := range cases {
+
+		_, err := Parse(c.Schema)
+
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("[case %d] expected a *ParseError but got %#v", i, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(*perr, c.Error) {
+			t.Errorf("[case %d] unexpected parse error: expected\n%#v\nbut got\n%#v", i, c.Error, *perr)
+		}
+
+	}
+
+}
+
+func TestParseError_Error(t *testing.T) {
+
+	_, err := Parse("{\n\tage number\n}")
+
+	expected := `jstn: 2:6: unexpected "number", expected "?" or ":"`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error message: expected %q but got %v", expected, err)
+	}
+
+	_, err = Parse(`string(pattern="[")`)
+
+	expected = "jstn: 1:16: invalid pattern \"[\": error parsing regexp: missing closing ]: `[`"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error message: expected %q but got %v", expected, err)
+	}
+
+	_, err = Parse(`{["("]: string}`)
+
+	expected = "jstn: 1:3: invalid key pattern \"(\": error parsing regexp: missing closing ): `(`"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error message: expected %q but got %v", expected, err)
+	}
+
+}
@@ -3,6 +3,8 @@ package jstn
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"strings"
 )
@@ -17,15 +19,24 @@ const (
 	EOF
 	WHITESPACE
 	NEWLINE
+	COMMENT
+	DOCCOMMENT
 
 	// Literals
 	IDENT
+	STRINGLIT // "text"
+	NUMBERLIT // 12.5
+	VALUELIT  // any JSON value, such as [1, "a"]
 
 	// Known identifiers
 	STRING  // string
 	NUMBER  // number
+	INTEGER // integer
 	BOOLEAN // boolean
 	NULL    // null
+	ANY     // any
+	OBJECT  // object
+	ARRAY   // array
 
 	// Structural characters
 	CURLYOPEN   // {
@@ -35,6 +46,15 @@ const (
 	COLON       // :
 	SEMICOLON   // ;
 	QUESTION    // ?
+	PIPE        // |
+	COMMA       // ,
+	ELLIPSIS    // ...
+	EQUALS      // =
+	PERIOD      // .
+	PARENOPEN   // (
+	PARENCLOSE  // )
+	ANGLEOPEN   // <
+	ANGLECLOSE  // >
 )
 
 func (t token) String() string {
@@ -46,7 +66,12 @@ var tokens = map[token]string{
 	EOF:         "EOF",
 	WHITESPACE:  "WHITESPACE",
 	NEWLINE:     "NEWLINE",
+	COMMENT:     "COMMENT",
+	DOCCOMMENT:  "DOCCOMMENT",
 	IDENT:       "IDENT",
+	STRINGLIT:   "STRINGLIT",
+	NUMBERLIT:   "NUMBERLIT",
+	VALUELIT:    "VALUELIT",
 	CURLYOPEN:   "CURLYOPEN",
 	CURLYCLOSE:  "CURLYCLOSE",
 	SQUAREOPEN:  "SQUAREOPEN",
@@ -54,10 +79,77 @@ var tokens = map[token]string{
 	COLON:       "COLON",
 	SEMICOLON:   "SEMICOLON",
 	QUESTION:    "QUESTION",
+	PIPE:        "PIPE",
+	COMMA:       "COMMA",
+	ELLIPSIS:    "ELLIPSIS",
+	EQUALS:      "EQUALS",
+	PERIOD:      "PERIOD",
+	PARENOPEN:   "PARENOPEN",
+	PARENCLOSE:  "PARENCLOSE",
+	ANGLEOPEN:   "ANGLEOPEN",
+	ANGLECLOSE:  "ANGLECLOSE",
 	STRING:      "STRING",
 	NUMBER:      "NUMBER",
+	INTEGER:     "INTEGER",
 	BOOLEAN:     "BOOLEAN",
 	NULL:        "NULL",
+	ANY:         "ANY",
+	OBJECT:      "OBJECT",
+	ARRAY:       "ARRAY",
+}
+
+// describe renders t for use in error messages, which for structural
+// characters and keywords is the text of the token itself.
+func (t token) describe() string {
+	switch t {
+	case EOF:
+		return "end of input"
+	case NEWLINE:
+		return "newline"
+	case IDENT:
+		return "identifier"
+	case STRINGLIT:
+		return "string literal"
+	case NUMBERLIT:
+		return "number literal"
+	case VALUELIT:
+		return "JSON value"
+	case ILLEGAL, WHITESPACE, COMMENT, DOCCOMMENT:
+		return strings.ToLower(t.String())
+	}
+	return fmt.Sprintf("%q", literals[t])
+}
+
+// isKeyword reports whether t is one of the known identifiers.
+func (t token) isKeyword() bool {
+	return t >= STRING && t <= ARRAY
+}
+
+var literals = map[token]string{
+	STRING:      "string",
+	NUMBER:      "number",
+	INTEGER:     "integer",
+	BOOLEAN:     "boolean",
+	NULL:        "null",
+	ANY:         "any",
+	OBJECT:      "object",
+	ARRAY:       "array",
+	CURLYOPEN:   "{",
+	CURLYCLOSE:  "}",
+	SQUAREOPEN:  "[",
+	SQUARECLOSE: "]",
+	COLON:       ":",
+	SEMICOLON:   ";",
+	QUESTION:    "?",
+	PIPE:        "|",
+	COMMA:       ",",
+	ELLIPSIS:    "...",
+	EQUALS:      "=",
+	PERIOD:      ".",
+	PARENOPEN:   "(",
+	PARENCLOSE:  ")",
+	ANGLEOPEN:   "<",
+	ANGLECLOSE:  ">",
 }
 
 func isWhitespace(ch rune) bool {
@@ -76,23 +168,57 @@ func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
 
+// A Position describes a location in a JSTN text.
+type Position struct {
+	Filename string // the name of the file containing the text, if any
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number in bytes, starting at 1
+}
+
+func (p Position) String() string {
+	if p.Line == 0 && p.Filename != "" {
+		// a position in no particular part of a file
+		return p.Filename
+	}
+	if p.Filename != "" {
+		return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
 type scanner struct {
-	r *bufio.Reader
+	r    *bufio.Reader
+	pos  Position // the position of the next rune to be read
+	prev Position // the position of the last rune read, for unread
 }
 
 func newScanner(r io.Reader) *scanner {
-	return &scanner{r: bufio.NewReader(r)}
+	return &scanner{r: bufio.NewReader(r), pos: Position{Line: 1, Column: 1}}
 }
 
 func (s *scanner) read() rune {
-	ch, _, err := s.r.ReadRune()
+	ch, size, err := s.r.ReadRune()
 	if err != nil {
 		return eof
 	}
+
+	s.prev = s.pos
+	s.pos.Offset += size
+	if ch == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column += size
+	}
+
 	return ch
 }
 
-func (s *scanner) unread() { _ = s.r.UnreadRune() }
+func (s *scanner) unread() {
+	_ = s.r.UnreadRune()
+	s.pos = s.prev
+}
 
 func (s *scanner) Scan() (tok token, lit string) {
 
@@ -111,6 +237,18 @@ func (s *scanner) Scan() (tok token, lit string) {
 	case isLetter(ch):
 		s.unread()
 		return s.scanIdent()
+	case ch == '/':
+		s.unread()
+		return s.scanComment()
+	case ch == '"':
+		s.unread()
+		return s.scanString()
+	case ch == '-' || isDigit(ch):
+		s.unread()
+		return s.scanNumber()
+	case ch == '.':
+		s.unread()
+		return s.scanPeriods()
 	case ch == eof:
 		return EOF, ""
 	}
@@ -123,6 +261,13 @@ func (s *scanner) Scan() (tok token, lit string) {
 		':': COLON,
 		';': SEMICOLON,
 		'?': QUESTION,
+		'|': PIPE,
+		',': COMMA,
+		'=': EQUALS,
+		'(': PARENOPEN,
+		')': PARENCLOSE,
+		'<': ANGLEOPEN,
+		'>': ANGLECLOSE,
 	}
 
 	if tok, ok := chars[ch]; ok {
@@ -151,6 +296,36 @@ func (s *scanner) scanRunes(t token, matcher func(rune) bool) (tok token, lit st
 
 }
 
+// scanFormatName scans the name of a string format, which unlike an
+// identifier may contain hyphens. The name is empty if none is found.
+func (s *scanner) scanFormatName() (tok token, lit string) {
+	return s.scanRunes(IDENT, isFormatRune)
+}
+
+// scanValue scans a JSON value of any type, which unlike other tokens may
+// span several lines, from src, the whole of the text being scanned. If no
+// valid value is found, scanValue returns ILLEGAL and the rest of the line.
+func (s *scanner) scanValue(src string) (tok token, lit string) {
+
+	rest := src[s.pos.Offset:]
+	d := json.NewDecoder(strings.NewReader(rest))
+	var raw json.RawMessage
+	if err := d.Decode(&raw); err == io.EOF {
+		return EOF, ""
+	} else if err != nil {
+		_, lit = s.scanRunes(ILLEGAL, func(r rune) bool {
+			return !isNewline(r)
+		})
+		return ILLEGAL, lit
+	}
+
+	for end := s.pos.Offset + int(d.InputOffset()); s.pos.Offset < end; {
+		s.read()
+	}
+	return VALUELIT, rest[:d.InputOffset()]
+
+}
+
 func (s *scanner) scanWhitespace() (tok token, lit string) {
 	return s.scanRunes(WHITESPACE, func(r rune) bool {
 		return isWhitespace(r)
@@ -169,6 +344,9 @@ func (s *scanner) scanIdent() (tok token, lit string) {
 		return isLetter(r) || isDigit(r) || r == '_'
 	})
 
+	// string, number, boolean and null have always been matched in any case,
+	// and still are; the later keywords must be lowercase, so that names like
+	// Object remain free for named types
 	switch strings.ToLower(lit) {
 	case "string":
 		return STRING, lit
@@ -180,6 +358,137 @@ func (s *scanner) scanIdent() (tok token, lit string) {
 		return NULL, lit
 	}
 
+	switch lit {
+	case "integer":
+		return INTEGER, lit
+	case "any":
+		return ANY, lit
+	case "object":
+		return OBJECT, lit
+	case "array":
+		return ARRAY, lit
+	}
+
 	return tok, lit
 
 }
+
+// scanComment scans a line comment, which runs from "//" to the end of the
+// line, or a block comment, which runs from "/*" to the next "*/". Comments
+// beginning with exactly "///" or "/**" are documentation comments.
+func (s *scanner) scanComment() (tok token, lit string) {
+
+	var buf bytes.Buffer
+	buf.WriteRune(s.read()) // the leading '/'
+
+	switch ch := s.read(); ch {
+	case '/':
+		buf.WriteRune(ch)
+		_, text := s.scanRunes(COMMENT, func(r rune) bool {
+			return !isNewline(r)
+		})
+		buf.WriteString(text)
+		if strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//") {
+			return DOCCOMMENT, buf.String()
+		}
+		return COMMENT, buf.String()
+
+	case '*':
+		buf.WriteRune(ch)
+		for prev, ch := eof, eof; prev != '*' || ch != '/'; {
+			prev, ch = ch, s.read()
+			if ch == eof {
+				// the comment is never terminated
+				return ILLEGAL, buf.String()
+			}
+			buf.WriteRune(ch)
+		}
+		lit := buf.String()
+		if strings.HasPrefix(lit, "/**") && !strings.HasPrefix(lit, "/***") && lit != "/**/" {
+			return DOCCOMMENT, lit
+		}
+		return COMMENT, lit
+
+	default:
+		if ch != eof {
+			s.unread()
+		}
+		return ILLEGAL, buf.String()
+	}
+
+}
+
+// scanString scans a string literal, which has the syntax of a JSON string.
+// The literal includes the enclosing quotation marks and escape sequences.
+func (s *scanner) scanString() (tok token, lit string) {
+
+	var buf bytes.Buffer
+	buf.WriteRune(s.read()) // the opening '"'
+
+	for escaped := false; ; {
+		ch := s.read()
+		if ch == eof || isNewline(ch) {
+			// the string is never terminated
+			if ch != eof {
+				s.unread()
+			}
+			return ILLEGAL, buf.String()
+		}
+		buf.WriteRune(ch)
+
+		if escaped {
+			escaped = false
+		} else if ch == '\\' {
+			escaped = true
+		} else if ch == '"' {
+			break
+		}
+	}
+
+	// let the JSON decoder check the escape sequences
+	if !json.Valid(buf.Bytes()) {
+		return ILLEGAL, buf.String()
+	}
+
+	return STRINGLIT, buf.String()
+
+}
+
+// scanNumber scans a number literal, which has the syntax of a JSON number.
+func (s *scanner) scanNumber() (tok token, lit string) {
+
+	_, lit = s.scanRunes(NUMBERLIT, func(r rune) bool {
+		return isDigit(r) || r == '-' || r == '+' || r == '.' || r == 'e' || r == 'E'
+	})
+
+	if !json.Valid([]byte(lit)) {
+		return ILLEGAL, lit
+	}
+
+	return NUMBERLIT, lit
+
+}
+
+// scanPeriods scans either a single period or an ellipsis, returning ILLEGAL
+// for two periods.
+func (s *scanner) scanPeriods() (tok token, lit string) {
+
+	for len(lit) < 3 {
+		if ch := s.read(); ch != '.' {
+			if ch != eof {
+				s.unread()
+			}
+			break
+		}
+		lit += "."
+	}
+
+	switch lit {
+	case ".":
+		return PERIOD, lit
+	case "...":
+		return ELLIPSIS, lit
+	}
+	return ILLEGAL, lit
+
+}
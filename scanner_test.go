@@ -77,3 +77,188 @@ func TestScanner(t *testing.T) {
 	}
 
 }
+
+func TestScanner_Comments(t *testing.T) {
+
+	cases := []struct {
+		Text    string
+		Tokens  []token
+		Literal string // the literal of the first token
+	}{
+		{
+			Text:    "// line comment\nstring",
+			Tokens:  []token{COMMENT, NEWLINE, STRING},
+			Literal: "// line comment",
+		},
+		{
+			Text:    "/* block\ncomment */string",
+			Tokens:  []token{COMMENT, STRING},
+			Literal: "/* block\ncomment */",
+		},
+		{
+			Text:    "/***/",
+			Tokens:  []token{COMMENT},
+			Literal: "/***/",
+		},
+		{
+			Text:    "/// doc comment\nstring",
+			Tokens:  []token{DOCCOMMENT, NEWLINE, STRING},
+			Literal: "/// doc comment",
+		},
+		{
+			Text:    "//// not a doc comment",
+			Tokens:  []token{COMMENT},
+			Literal: "//// not a doc comment",
+		},
+		{
+			Text:    "/** doc comment */",
+			Tokens:  []token{DOCCOMMENT},
+			Literal: "/** doc comment */",
+		},
+		{
+			Text:    "/**/",
+			Tokens:  []token{COMMENT},
+			Literal: "/**/",
+		},
+		{
+			Text:    "/* unterminated *",
+			Tokens:  []token{ILLEGAL},
+			Literal: "/* unterminated *",
+		},
+		{
+			Text:    "/string",
+			Tokens:  []token{ILLEGAL, STRING},
+			Literal: "/",
+		},
+	}
+
+	for i, c := range cases {
+
+		var tokens []token
+		var first string
+
+		s := newScanner(strings.NewReader(c.Text))
+		for {
+			tok, lit := s.Scan()
+			if tok == EOF {
+				break
+			}
+			if tokens == nil {
+				first = lit
+			}
+			tokens = append(tokens, tok)
+		}
+
+		if !reflect.DeepEqual(c.Tokens, tokens) || first != c.Literal {
+			t.Errorf("[case %d] unexpected scan: expected %v (%q) but got %v (%q)", i, c.Tokens, c.Literal, tokens, first)
+		}
+
+	}
+
+}
+
+func TestScanner_Literals(t *testing.T) {
+
+	cases := []struct {
+		Text    string
+		Tokens  []token
+		Literal string // the literal of the first token
+	}{
+		{
+			Text:    `"active"|"deleted"`,
+			Tokens:  []token{STRINGLIT, PIPE, STRINGLIT},
+			Literal: `"active"`,
+		},
+		{
+			Text:    `"say \"hi\" \u00e9"`,
+			Tokens:  []token{STRINGLIT},
+			Literal: `"say \"hi\" \u00e9"`,
+		},
+		{
+			Text:    "-1.5e+3?",
+			Tokens:  []token{NUMBERLIT, QUESTION},
+			Literal: "-1.5e+3",
+		},
+		{
+			Text:    "0]",
+			Tokens:  []token{NUMBERLIT, SQUARECLOSE},
+			Literal: "0",
+		},
+		{
+			Text:    "01",
+			Tokens:  []token{ILLEGAL},
+			Literal: "01",
+		},
+		{
+			Text:    "1.",
+			Tokens:  []token{ILLEGAL},
+			Literal: "1.",
+		},
+		{
+			Text:    `"bad \q escape"`,
+			Tokens:  []token{ILLEGAL},
+			Literal: `"bad \q escape"`,
+		},
+		{
+			Text:    "\"unterminated\nstring",
+			Tokens:  []token{ILLEGAL, NEWLINE, STRING},
+			Literal: `"unterminated`,
+		},
+	}
+
+	for i, c := range cases {
+
+		var tokens []token
+		var first string
+
+		s := newScanner(strings.NewReader(c.Text))
+		for {
+			tok, lit := s.Scan()
+			if tok == EOF {
+				break
+			}
+			if tokens == nil {
+				first = lit
+			}
+			tokens = append(tokens, tok)
+		}
+
+		if !reflect.DeepEqual(c.Tokens, tokens) || first != c.Literal {
+			t.Errorf("[case %d] unexpected scan: expected %v (%q) but got %v (%q)", i, c.Tokens, c.Literal, tokens, first)
+		}
+
+	}
+
+}
+
+func TestScanner_Position(t *testing.T) {
+
+	s := newScanner(strings.NewReader("{\n\tkey: string\n}"))
+
+	var positions []Position
+	for {
+		pos := s.pos
+		tok, _ := s.Scan()
+		if tok == EOF {
+			break
+		}
+		positions = append(positions, pos)
+	}
+
+	expected := []Position{
+		{Offset: 0, Line: 1, Column: 1},   // {
+		{Offset: 1, Line: 1, Column: 2},   // newline
+		{Offset: 2, Line: 2, Column: 1},   // whitespace
+		{Offset: 3, Line: 2, Column: 2},   // key
+		{Offset: 6, Line: 2, Column: 5},   // :
+		{Offset: 7, Line: 2, Column: 6},   // whitespace
+		{Offset: 8, Line: 2, Column: 7},   // string
+		{Offset: 14, Line: 2, Column: 13}, // newline
+		{Offset: 15, Line: 3, Column: 1},  // }
+	}
+
+	if !reflect.DeepEqual(expected, positions) {
+		t.Errorf("unexpected positions: expected %v but got %v\n", expected, positions)
+	}
+
+}
@@ -0,0 +1,270 @@
+package jstn
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// A Record is the result of validating one JSON value in a stream.
+type Record struct {
+	Index  int   // the position of the value in the stream, starting at 0
+	Offset int64 // the byte offset of the start of the value in the stream
+	Err    error // the validation failure, or nil if the value is valid
+}
+
+// ValidateStream validates each of the JSON values in the stream read from r,
+// such as a newline-delimited JSON file, against t. It calls fn with the
+// result for each value in input order, and stops early if fn returns an
+// error. Offsets reported in validation failures are relative to the start
+// of the stream.
+//
+// A value that isn't well-formed JSON is reported as a record of its own,
+// whose error has the reason MalformedJSON, and validation resumes on the
+// line after the one on which that value begins. In a newline-delimited file,
+// a corrupt line is therefore reported as a single record, and the records
+// that follow it are unaffected.
+//
+// ValidateStream returns the error returned by fn, if any, or a
+// *ValidationError if r itself fails.
+func ValidateStream(t Type, r io.Reader, fn func(Record) error) error {
+	return ValidatorOptions{}.ValidateStream(t, r, fn)
+}
+
+// ValidateStream is like the ValidateStream function, but validates each
+// value according to the options in o. If o.Workers is greater than one,
+// values are validated concurrently, but fn is still called sequentially and
+// in input order. Either way, r is only read by the calling goroutine, and
+// never once ValidateStream has returned.
+func (o ValidatorOptions) ValidateStream(t Type, r io.Reader, fn func(Record) error) error {
+	c, err := o.Compile(t)
+	if err != nil {
+		return err
+	}
+	return c.ValidateStream(r, fn)
+}
+
+// ValidateStream is like the ValidateStream function, but validates each
+// value against the compiled type.
+func (v *Validator) ValidateStream(r io.Reader, fn func(Record) error) error {
+
+	o := v.opts
+	s := newStreamer(r, v.root.kind)
+
+	if o.Workers <= 1 {
+		for {
+			rec, raw, err := s.next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if rec.Err == nil {
+				rec.Err = v.validateAt(raw, rec.Offset)
+			}
+
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+	}
+
+	// This goroutine reads the values from the stream and hands each to a
+	// pool of workers, noting it in the pending queue, and then waits for
+	// each value in the queue to be validated in turn. The capacity of the
+	// queue bounds how far ahead of fn the reading may run, so that the
+	// workers' channel never blocks. Nothing reads from r once this returns.
+	type job struct {
+		rec  Record
+		raw  json.RawMessage
+		done chan struct{}
+	}
+
+	jobs := make(chan *job, o.Workers)
+	pending := make(chan *job, o.Workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				j.rec.Err = v.validateAt(j.raw, j.rec.Offset)
+				close(j.done)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	var readErr error
+	for {
+		for readErr == nil && len(pending) < cap(pending) {
+			rec, raw, err := s.next()
+			if err != nil {
+				readErr = err
+				break
+			}
+			j := &job{rec: rec, raw: raw, done: make(chan struct{})}
+			pending <- j
+			if rec.Err != nil {
+				close(j.done) // malformed, so there's nothing to validate
+			} else {
+				jobs <- j
+			}
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		j := <-pending
+		<-j.done
+		if err := fn(j.rec); err != nil {
+			return err
+		}
+	}
+
+	if readErr == io.EOF {
+		return nil
+	}
+	return readErr
+
+}
+
+// validateAt validates a single value found at offset in a stream.
+func (v *Validator) validateAt(raw json.RawMessage, offset int64) error {
+	val := newBytesValidator(raw, v.opts)
+	defer val.release()
+	val.base = offset
+	return val.validate(v.root)
+}
+
+// A streamer splits a stream into its individual JSON values. It keeps the
+// bytes read from the stream that haven't yet been decoded, so that after a
+// malformed value it can skip to the next line and decode afresh from there.
+type streamer struct {
+	r    io.Reader
+	d    *json.Decoder
+	kind Kind // the kind of the type the values are validated against
+	n    int  // the number of values read so far
+
+	buf  []byte // the bytes read from r that haven't been decoded
+	fed  int    // the number of bytes of buf given to d
+	off  int64  // the offset in the stream of buf
+	base int64  // the offset in the stream of d's input
+	err  error  // the error that ended reading r, if any
+}
+
+func newStreamer(r io.Reader, kind Kind) *streamer {
+	s := &streamer{r: r, kind: kind}
+	s.d = json.NewDecoder(s)
+	return s
+}
+
+// next reads the next value from the stream, returning io.EOF once there are
+// no more. A malformed value is returned as a record with an error, unless
+// reading the stream itself failed.
+func (s *streamer) next() (Record, json.RawMessage, error) {
+
+	var raw json.RawMessage
+	if err := s.d.Decode(&raw); err == io.EOF {
+		return Record{}, nil, io.EOF
+	} else if err != nil {
+		verr := &ValidationError{
+			Reason:   MalformedJSON,
+			Expected: s.kind,
+			Offset:   s.base + s.d.InputOffset(),
+			Err:      err,
+		}
+		if s.err != nil && s.err != io.EOF {
+			return Record{}, nil, verr
+		}
+		rec := Record{Index: s.n, Offset: s.skipLine(), Err: verr}
+		s.n++
+		return rec, nil, nil
+	}
+
+	end := s.base + s.d.InputOffset()
+	rec := Record{Index: s.n, Offset: end - int64(len(raw))}
+	s.n++
+
+	// forget what has been decoded, keeping only what d has yet to decode
+	n := int(end - s.off)
+	s.buf = s.buf[:copy(s.buf, s.buf[n:])]
+	s.fed -= n
+	s.off = end
+
+	return rec, raw, nil
+
+}
+
+// skipLine discards the malformed value at the start of the undecoded input,
+// up to and including the end of the line on which it begins, and returns the
+// offset at which it begins. Decoding resumes with the following line.
+func (s *streamer) skipLine() int64 {
+
+	i := 0
+	for i < len(s.buf) && isSpace(s.buf[i]) {
+		i++
+	}
+	start := s.off + int64(i)
+
+	for {
+		if j := bytes.IndexByte(s.buf[i:], '\n'); j >= 0 {
+			i += j + 1
+			break
+		}
+		s.off += int64(len(s.buf))
+		s.buf, i = s.buf[:0], 0
+		if s.err != nil {
+			break
+		}
+		s.fill()
+	}
+
+	s.buf = s.buf[:copy(s.buf, s.buf[i:])]
+	s.off += int64(i)
+	s.fed, s.base = 0, s.off
+	s.d = json.NewDecoder(s)
+	return start
+
+}
+
+// Read gives the decoder the bytes it hasn't yet been given, reading more
+// from the stream once those are used up.
+func (s *streamer) Read(p []byte) (int, error) {
+	if s.fed == len(s.buf) {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.fill()
+	}
+	n := copy(p, s.buf[s.fed:])
+	s.fed += n
+	if n == 0 {
+		return 0, s.err
+	}
+	return n, nil
+}
+
+// fill reads more of the stream into buf.
+func (s *streamer) fill() {
+	if len(s.buf) == cap(s.buf) {
+		buf := make([]byte, len(s.buf), 2*cap(s.buf)+4096)
+		copy(buf, s.buf)
+		s.buf = buf
+	}
+	n, err := s.r.Read(s.buf[len(s.buf):cap(s.buf)])
+	s.buf = s.buf[:len(s.buf)+n]
+	if err != nil {
+		s.err = err
+	}
+}
+
+// isSpace reports whether c is JSON whitespace.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,211 @@
+package jstn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+var eventStream = `{"id":1,"kind":"click"}
+{"id":2,"kind":3}
+{"id":"3","kind":"view"}
+
+{"id":4,"kind":"view"}
+`
+
+func TestValidateStream(t *testing.T) {
+
+	schema := MustParse(`{id: number; kind: string}`)
+
+	expected := []Record{
+		{Index: 0, Offset: 0},
+		{Index: 1, Offset: 24, Err: &ValidationError{Path: "/kind", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 40}},
+		{Index: 2, Offset: 42, Err: &ValidationError{Path: "/id", Reason: TypeMismatch, Expected: Number, Actual: "string", Offset: 51}},
+		{Index: 3, Offset: 68},
+	}
+
+	for _, workers := range []int{0, 1, 3} {
+
+		var records []Record
+		err := ValidatorOptions{Workers: workers}.ValidateStream(schema, strings.NewReader(eventStream), func(rec Record) error {
+			records = append(records, rec)
+			return nil
+		})
+
+		if err != nil {
+			t.Errorf("[workers %d] unexpected error: %s", workers, err)
+		}
+
+		if !reflect.DeepEqual(records, expected) {
+			t.Errorf("[workers %d] unexpected records: expected\n%v\nbut got\n%v", workers, expected, records)
+		}
+
+	}
+
+}
+
+func TestValidateStream_Order(t *testing.T) {
+
+	schema := MustParse(`{id: number}`)
+
+	var buf strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&buf, "{\"id\":%d}\n", i)
+	}
+
+	next := 0
+	err := ValidatorOptions{Workers: 8}.ValidateStream(schema, strings.NewReader(buf.String()), func(rec Record) error {
+		if rec.Index != next {
+			return fmt.Errorf("got record %d but expected %d", rec.Index, next)
+		}
+		next++
+		return rec.Err
+	})
+
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+}
+
+func TestValidateStream_Stop(t *testing.T) {
+
+	stop := errors.New("stop")
+
+	for _, workers := range []int{1, 4} {
+
+		var n int
+		err := ValidatorOptions{Workers: workers}.ValidateStream(Type{Kind: Number}, strings.NewReader("1 2 3 4 5 6"), func(rec Record) error {
+			if n++; rec.Index == 2 {
+				return stop
+			}
+			return nil
+		})
+
+		if err != stop || n != 3 {
+			t.Errorf("[workers %d] unexpected result: got error %v after %d records", workers, err, n)
+		}
+
+	}
+
+}
+
+func TestValidateStream_StopReading(t *testing.T) {
+
+	stop := errors.New("stop")
+
+	// once the values given are used up, the reader blocks until the end of
+	// the test, so reading beyond them would outlive ValidateStream
+	r := &stallingReader{r: strings.NewReader("1 2 3 "), stall: make(chan struct{})}
+	defer close(r.stall)
+
+	err := ValidatorOptions{Workers: 2}.ValidateStream(Type{Kind: Number}, r, func(rec Record) error {
+		return stop
+	})
+
+	if err != stop {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&r.stalled) != 0 {
+		t.Errorf("unexpected read beyond the values needed")
+	}
+
+}
+
+// A stallingReader reads from r, and then blocks until stall is closed.
+type stallingReader struct {
+	r       io.Reader
+	stall   chan struct{}
+	stalled int32
+}
+
+func (s *stallingReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err == io.EOF {
+		atomic.StoreInt32(&s.stalled, 1)
+		<-s.stall
+	}
+	return n, err
+}
+
+func TestValidateStream_Malformed(t *testing.T) {
+
+	schema := MustParse(`{id: number}`)
+
+	// a corrupt line is a record of its own, and later lines are unaffected
+	stream := `{"id":1}
+{"id":2,"kind":
+{"id":"3"}
+{"id":4]  {"id":5}
+{"id":6}
+{"id":`
+
+	expected := []Record{
+		{Index: 0, Offset: 0},
+		{Index: 1, Offset: 9, Err: &ValidationError{Reason: MalformedJSON, Expected: Object, Offset: 8}},
+		{Index: 2, Offset: 25, Err: &ValidationError{Path: "/id", Reason: TypeMismatch, Expected: Number, Actual: "string", Offset: 34}},
+		{Index: 3, Offset: 36, Err: &ValidationError{Reason: MalformedJSON, Expected: Object, Offset: 35}},
+		{Index: 4, Offset: 55},
+		{Index: 5, Offset: 64, Err: &ValidationError{Reason: MalformedJSON, Expected: Object, Offset: 63}},
+	}
+
+	for _, workers := range []int{1, 3} {
+
+		var records []Record
+		err := ValidatorOptions{Workers: workers}.ValidateStream(schema, strings.NewReader(stream), func(rec Record) error {
+			records = append(records, rec)
+			return nil
+		})
+
+		if err != nil {
+			t.Errorf("[workers %d] unexpected error: %s", workers, err)
+		}
+
+		if len(records) != len(expected) {
+			t.Errorf("[workers %d] unexpected records: expected\n%v\nbut got\n%v", workers, expected, records)
+			continue
+		}
+
+		for i, rec := range records {
+			// the decoding errors themselves aren't compared
+			if verr, ok := rec.Err.(*ValidationError); ok && verr.Reason == MalformedJSON {
+				if verr.Err == nil {
+					t.Errorf("[workers %d] record %d lacks a decoding error", workers, i)
+				}
+				verr.Err = nil
+			}
+			if !reflect.DeepEqual(rec, expected[i]) {
+				t.Errorf("[workers %d] unexpected record %d: expected\n%+v\nbut got\n%+v", workers, i, expected[i], rec)
+			}
+		}
+
+	}
+
+}
+
+func TestValidateStream_ReadError(t *testing.T) {
+
+	broken := errors.New("broken")
+	r := io.MultiReader(strings.NewReader("1 2 "), &errReader{broken})
+
+	var n int
+	err := ValidateStream(Type{Kind: Number}, r, func(rec Record) error {
+		n++
+		return rec.Err
+	})
+
+	verr, ok := err.(*ValidationError)
+	if !ok || verr.Reason != MalformedJSON || n != 2 {
+		t.Errorf("unexpected result: got error %#v after %d records", err, n)
+	}
+
+}
+
+// An errReader fails every read with err.
+type errReader struct{ err error }
+
+func (r *errReader) Read(p []byte) (int, error) { return 0, r.err }
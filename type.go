@@ -2,6 +2,8 @@ package jstn
 
 import (
 	"encoding/json"
+	"sort"
+	"strconv"
 )
 
 // A Kind represents a primitive JSON type.
@@ -14,13 +16,97 @@ const (
 	Null
 	Object
 	Array
+	Union
+	Literal
+	Integer
+	Tuple
+	Map
+	Reference
+	Any
 )
 
+func (k Kind) String() string {
+	switch k {
+	case String:
+		return "string"
+	case Number:
+		return "number"
+	case Boolean:
+		return "boolean"
+	case Null:
+		return "null"
+	case Object:
+		return "object"
+	case Array:
+		return "array"
+	case Union:
+		return "union"
+	case Literal:
+		return "literal"
+	case Integer:
+		return "integer"
+	case Tuple:
+		return "tuple"
+	case Map:
+		return "map"
+	case Reference:
+		return "reference"
+	case Any:
+		return "any"
+	default:
+		return "Kind(" + strconv.Itoa(int(k)) + ")"
+	}
+}
+
 type Type struct {
-	Kind       Kind
-	Optional   bool
-	Properties map[string]*Type // Only for Objects
-	Items      *Type            // Only for Arrays
+	Kind         Kind
+	Optional     bool             // Whether a value may be absent or null, like Omittable and Nullable together
+	Omittable    bool             // Only for object properties: whether the property may be absent
+	Nullable     bool             // Whether a value may be null
+	Properties   map[string]*Type // Only for Objects
+	Order        []string         // Only for Objects: the order of Properties
+	Open         bool             // Only for Objects: whether undeclared properties are permitted
+	Items        *Type            // Only for Arrays
+	Elements     []*Type          // Only for Tuples: the type of each position
+	Values       *Type            // Only for Maps: the type of every value
+	KeyPattern   string           // Only for Maps: a regular expression that keys must match, if any
+	Alternatives []*Type          // Only for Unions; Optional is ignored on each
+	Value        json.RawMessage  // Only for Literals: a JSON string or number
+	Name         string           // Only for References: the name of the referenced type
+	Target       *Type            // Only for References: the named type, once resolved
+	Import       string           // Only for References to imported types: the path of the import
+	Format       string           // Only for Strings: the name of the format that values must have, if any
+	Constraints  *Constraints     // Restrictions on values beyond their kind, if any
+	Default      json.RawMessage  // Only for object properties that may be omitted: the value when absent, if any
+	Description  string           // Documentation for an object property or a named type's definition
+}
+
+// PropertyNames returns the names of the properties of an object type in
+// order. This is the order given by t.Order, followed by any properties that
+// Order omits sorted by name. Names in Order that aren't in t.Properties are
+// ignored.
+func (t Type) PropertyNames() []string {
+
+	names := make([]string, 0, len(t.Properties))
+	listed := make(map[string]bool, len(t.Order))
+
+	for _, k := range t.Order {
+		if _, ok := t.Properties[k]; ok && !listed[k] {
+			names = append(names, k)
+			listed[k] = true
+		}
+	}
+
+	var rest []string
+	for k := range t.Properties {
+		if !listed[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+
+	return append(names, rest...)
+
 }
 
 func (t Type) String() string {
@@ -47,3 +133,59 @@ func (t *Type) UnmarshalJSON(b []byte) error {
 	*t = tt
 	return err
 }
+
+// Constraints restrict the values of a type beyond those of its kind. Each
+// constraint applies only to certain kinds, and a zero field imposes no
+// restriction.
+type Constraints struct {
+	Min         json.Number // Only for Numbers and Integers: the least value permitted
+	Max         json.Number // Only for Numbers and Integers: the greatest value permitted
+	MinLength   *int        // Only for Strings: the fewest characters permitted
+	MaxLength   *int        // Only for Strings: the most characters permitted
+	Pattern     string      // Only for Strings: a regular expression that values must match
+	MinItems    *int        // Only for Arrays: the fewest elements permitted
+	MaxItems    *int        // Only for Arrays: the most elements permitted
+	UniqueItems bool        // Only for Arrays: whether elements must all differ
+}
+
+// constraintKinds lists the kinds that each constraint applies to, by its
+// name in a JSTN text.
+var constraintKinds = map[string][]Kind{
+	"min":         {Number, Integer},
+	"max":         {Number, Integer},
+	"minLength":   {String},
+	"maxLength":   {String},
+	"pattern":     {String},
+	"minItems":    {Array},
+	"maxItems":    {Array},
+	"uniqueItems": {Array},
+}
+
+// constraintApplies reports whether the named constraint applies to kind k.
+func constraintApplies(name string, k Kind) bool {
+	for _, kind := range constraintKinds[name] {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+// names lists the names of the constraints set in c.
+func (c *Constraints) names() []string {
+	var names []string
+	add := func(name string, set bool) {
+		if set {
+			names = append(names, name)
+		}
+	}
+	add("min", c.Min != "")
+	add("max", c.Max != "")
+	add("minLength", c.MinLength != nil)
+	add("maxLength", c.MaxLength != nil)
+	add("pattern", c.Pattern != "")
+	add("minItems", c.MinItems != nil)
+	add("maxItems", c.MaxItems != nil)
+	add("uniqueItems", c.UniqueItems)
+	return names
+}
@@ -54,3 +54,46 @@ func TestUnmarshalType_NotString(t *testing.T) {
 	}
 
 }
+
+func TestKindString(t *testing.T) {
+
+	cases := map[Kind]string{
+		String:    "string",
+		Number:    "number",
+		Boolean:   "boolean",
+		Null:      "null",
+		Object:    "object",
+		Array:     "array",
+		Union:     "union",
+		Literal:   "literal",
+		Integer:   "integer",
+		Tuple:     "tuple",
+		Map:       "map",
+		Reference: "reference",
+		Any:       "any",
+		Kind(99):  "Kind(99)",
+	}
+
+	for k, expected := range cases {
+		if actual := k.String(); actual != expected {
+			t.Errorf("unexpected string: expected %q but got %q", expected, actual)
+		}
+	}
+
+}
+
+func TestPropertyNames(t *testing.T) {
+
+	schema := Type{Kind: Object, Properties: map[string]*Type{
+		"c": &Type{Kind: String},
+		"b": &Type{Kind: String},
+		"a": &Type{Kind: String},
+		"d": &Type{Kind: String},
+	}, Order: []string{"d", "x", "b", "d"}}
+
+	expected := []string{"d", "b", "a", "c"}
+	if names := schema.PropertyNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected property names: expected %v but got %v", expected, names)
+	}
+
+}
@@ -3,281 +3,1273 @@ package jstn
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
-	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
+// A Reason classifies the way in which a JSON document fails to satisfy a
+// JSTN type.
+type Reason int
+
+const (
+	TypeMismatch          Reason = iota // a value is not of the declared type
+	MissingProperty                     // a required object property is absent
+	UndeclaredProperty                  // an object has a property its type does not declare
+	NonEmptyArray                       // an array declared as [] has elements
+	TrailingData                        // data follows the top-level value
+	MalformedJSON                       // the document is not well-formed JSON
+	NoMatchingAlternative               // a value matches none of the alternatives of a union
+	LiteralMismatch                     // a value differs from the declared literal
+	TupleLength                         // a tuple has too few or too many elements
+	InvalidKey                          // a map key doesn't match the key pattern
+	TooDeep                             // a value is nested more deeply than allowed
+	ConstraintViolation                 // a value violates a constraint of its type
+	InvalidFormat                       // a string doesn't have the declared format
+)
+
+var reasons = map[Reason]string{
+	TypeMismatch:          "type mismatch",
+	MissingProperty:       "missing required property",
+	UndeclaredProperty:    "undeclared property",
+	NonEmptyArray:         "non-empty array",
+	TrailingData:          "trailing data",
+	MalformedJSON:         "malformed JSON",
+	NoMatchingAlternative: "no matching alternative",
+	LiteralMismatch:       "literal mismatch",
+	TupleLength:           "wrong tuple length",
+	InvalidKey:            "invalid key",
+	TooDeep:               "maximum depth exceeded",
+	ConstraintViolation:   "constraint violation",
+	InvalidFormat:         "invalid format",
+}
+
+func (r Reason) String() string {
+	return reasons[r]
+}
+
+// A ValidationError describes where and how a JSON document fails to satisfy
+// a JSTN type.
+type ValidationError struct {
+	// Path is a JSON Pointer (RFC 6901) to the offending value, such as
+	// "/works/3/title". The empty string refers to the whole document.
+	Path string
+
+	Reason Reason
+
+	// Expected is the kind of the type declared at Path. For an undeclared
+	// property it is the kind of the enclosing object type.
+	Expected Kind
+
+	// Actual is the JSON type found at Path: "string", "number", "boolean",
+	// "null", "object", "array", or "end of input". It is empty when nothing
+	// was found, as for a missing property.
+	Actual string
+
+	// Detail further explains failures that concern a value rather than its
+	// type, such as by naming the literal that was expected or the
+	// constraint that was violated.
+	Detail string
+
+	// Offset is the number of bytes of input consumed when the failure was
+	// detected, which is usually just past the offending token.
+	Offset int64
+
+	// Err is the underlying decoding error for MalformedJSON.
+	Err error
+
+	// Alternatives holds, for NoMatchingAlternative, the failure of the
+	// value to match each alternative of the union in turn.
+	Alternatives []*ValidationError
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return "jstn: " + e.message()
+	}
+	return fmt.Sprintf("jstn: %s: %s", e.Path, e.message())
+}
+
+// message describes the failure without reference to its location.
+func (e *ValidationError) message() string {
+
+	var msg string
+
+	switch e.Reason {
+	case TypeMismatch:
+		msg = fmt.Sprintf("expected %s but got %s", e.Expected, e.Actual)
+	case MissingProperty:
+		msg = fmt.Sprintf("missing required property of type %s", e.Expected)
+	case UndeclaredProperty:
+		msg = fmt.Sprintf("undeclared property of type %s", e.Actual)
+	case NonEmptyArray:
+		msg = fmt.Sprintf("unexpected %s in array declared empty", e.Actual)
+	case TrailingData:
+		msg = fmt.Sprintf("unexpected %s after top-level value", e.Actual)
+	case MalformedJSON:
+		msg = fmt.Sprintf("malformed JSON: %s", e.Err)
+	case NoMatchingAlternative:
+		tried := make([]string, len(e.Alternatives))
+		for i, alt := range e.Alternatives {
+			if tried[i] = alt.message(); alt.Path != e.Path {
+				tried[i] = alt.Path + ": " + tried[i]
+			}
+		}
+		msg = fmt.Sprintf("%s matches no alternative (%s)", e.Actual, strings.Join(tried, "; "))
+	case LiteralMismatch, TupleLength, InvalidKey, TooDeep, ConstraintViolation, InvalidFormat:
+		msg = e.Detail
+	default:
+		msg = e.Reason.String()
+	}
+
+	return msg
+
+}
+
 // Valid indicates whether the JSON document in is considered valid with
 // respect to the JSTN structure t.
 func Valid(t Type, in json.RawMessage) bool {
-	d := json.NewDecoder(bytes.NewReader(in))
-	d.UseNumber()
+	return Validate(t, in) == nil
+}
+
+// Validate checks whether the JSON document in is valid with respect to the
+// JSTN structure t. It returns nil if so, and otherwise a *ValidationError
+// describing the first failure encountered.
+func Validate(t Type, in []byte) error {
+	return ValidatorOptions{}.Validate(t, in)
+}
+
+// ValidateAll is like Validate, except that it continues past each failure
+// and reports every failure in the document as a ValidationErrors. At most
+// limit failures are collected; a limit of zero or less collects them all.
+func ValidateAll(t Type, in []byte, limit int) error {
+	return ValidatorOptions{AllErrors: true, MaxErrors: limit}.Validate(t, in)
+}
+
+// ValidateReader is like Validate, except that it reads the JSON document
+// from r. The document is streamed rather than buffered in full, so r may
+// be arbitrarily large, with two exceptions: each value of a union type, and
+// each element of an array whose items must be unique, is read into memory
+// in full before it's checked. A document whose type is a union, or an array
+// with uniqueItems, is therefore held in memory entirely.
+func ValidateReader(t Type, r io.Reader) error {
+	return ValidatorOptions{}.ValidateReader(t, r)
+}
+
+// A Reporter is notified of each validation failure as it is found, for
+// instance to log or count invalid input.
+type Reporter interface {
+	Report(err *ValidationError)
+}
+
+// The ReporterFunc type is an adapter to allow the use of ordinary functions
+// as Reporters.
+type ReporterFunc func(err *ValidationError)
+
+// Report calls f(err).
+func (f ReporterFunc) Report(err *ValidationError) { f(err) }
+
+// ValidatorOptions configures how JSON documents are validated. The zero
+// value stops at the first failure and reports nothing.
+type ValidatorOptions struct {
+	// Reporter, if non-nil, is notified of every failure found.
+	Reporter Reporter
+
+	// AllErrors causes validation to continue past each failure and return
+	// every failure in the document as a ValidationErrors.
+	AllErrors bool
+
+	// MaxErrors limits the number of failures collected when AllErrors is
+	// set. Zero or less means no limit.
+	MaxErrors int
+
+	// OpenObjects permits undeclared properties in every object, as if each
+	// object type were open.
+	OpenObjects bool
+
+	// MaxDepth limits how deeply the values in a document may be nested,
+	// which guards against exhausting the stack when validating recursive
+	// types. Zero or less means a limit of 1000.
+	MaxDepth int
+
+	// Workers is the number of values ValidateStream validates concurrently.
+	// Zero or less means one.
+	Workers int
+
+	// anyFormat permits any string where a format isn't registered, rather
+	// than that being an error, for checking defaults as a document is parsed.
+	anyFormat bool
+}
+
+// Validate checks whether the JSON document in is valid with respect to the
+// JSTN structure t, according to the options in o.
+func (o ValidatorOptions) Validate(t Type, in []byte) error {
+	v := newBytesValidator(in, o)
+	defer v.release()
+	return v.walk(t)
+}
+
+// ValidateReader checks whether the JSON document read from r is valid with
+// respect to the JSTN structure t, according to the options in o. Like the
+// ValidateReader function, it streams the document, except for the values of
+// union types and the elements of arrays whose items must be unique, which
+// are each read into memory in full.
+func (o ValidatorOptions) ValidateReader(t Type, r io.Reader) error {
+	v := newValidator(r, o)
+	defer v.release()
+	return v.walk(t)
+}
+
+// defaultMaxDepth is the nesting limit used when ValidatorOptions.MaxDepth
+// isn't set.
+const defaultMaxDepth = 1000
+
+// ValidationErrors lists the failures found in a single JSON document, in
+// the order they were encountered.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the individual failures as a slice of errors.
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// A validator checks the JSON values read from a Decoder against compiled
+// JSTN types, or against uncompiled types by walking them, keeping track of
+// the path to the value under inspection.
+//
+// The validation methods return a non-nil error to signal that validation
+// must stop. With AllErrors set, failures are collected and the walk resumes
+// at the next sibling of the offending value, stopping only once MaxErrors
+// failures have been found or the JSON cannot be read any further. An
+// uncompiled type that turns out to be invalid also stops validation, with
+// an error other than a *ValidationError.
+//
+// Validators are pooled, and must be released once done with.
+type validator struct {
+	d       *json.Decoder
+	in      bytes.Reader // the document, if validating one held in memory
+	path    []segment
+	pathBuf [8]segment // initial storage for path
+
+	opts     ValidatorOptions
+	base     int64              // the offset of the document within a larger stream
+	errs     []*ValidationError // the failures found so far
+	depth    int                // the number of values being validated
+	maxDepth int                // the limit on depth
+
+	// When walking an uncompiled type, root is the type, and visited holds
+	// the nodes made as it's walked, one for each depth. The node of a
+	// value is only needed until the value has been validated, after which
+	// the node for its next sibling takes its place.
+	root    Type
+	visited []*node
+}
+
+// A segment is one step of the path to a JSON value: either an object
+// property name or, if index is not negative, an array index.
+type segment struct {
+	name  string
+	index int
+}
+
+var validators = sync.Pool{New: func() interface{} { return new(validator) }}
+
+// newValidator returns a validator of the document read from r.
+func newValidator(r io.Reader, opts ValidatorOptions) *validator {
+	v := validators.Get().(*validator)
+	v.reset(r, opts)
+	return v
+}
+
+// newBytesValidator returns a validator of the document in.
+func newBytesValidator(in []byte, opts ValidatorOptions) *validator {
+	v := validators.Get().(*validator)
+	v.in.Reset(in)
+	v.reset(&v.in, opts)
+	return v
+}
+
+// reset prepares v to validate the document read from r.
+func (v *validator) reset(r io.Reader, opts ValidatorOptions) {
+	v.d = json.NewDecoder(r)
+	v.d.UseNumber()
+	v.path = v.pathBuf[:0]
+	v.opts = opts
+	v.base, v.depth = 0, 0
+	v.maxDepth = opts.MaxDepth
+	if v.maxDepth <= 0 {
+		v.maxDepth = defaultMaxDepth
+	}
+}
+
+// release returns v to the pool. The failures it found remain with the
+// caller, so aren't reused.
+func (v *validator) release() {
+	v.d, v.errs = nil, nil
+	v.in.Reset(nil)
+	v.opts, v.root = ValidatorOptions{}, Type{}
+	validators.Put(v)
+}
+
+// walk checks that the Decoder holds exactly one JSON value of the uncompiled
+// type t, and returns the failures found.
+func (v *validator) walk(t Type) error {
+	v.root = t
+	n, err := v.visit(&v.root)
+	if err != nil {
+		return err
+	}
+	return v.validate(n)
+}
+
+// visit makes the node for t, which the walk of an uncompiled type has
+// reached at the current depth.
+func (v *validator) visit(t *Type) (*node, error) {
+
+	for len(v.visited) <= v.depth {
+		v.visited = append(v.visited, new(node))
+	}
+	n := v.visited[v.depth]
+
+	if err := n.init(t, v.opts.anyFormat); err != nil {
+		return nil, err
+	}
+
+	if t.Kind == Reference {
+		target, mods, err := followReference(*t)
+		if err != nil {
+			return nil, err
+		}
+		if err := n.init(target, v.opts.anyFormat); err != nil {
+			return nil, err
+		}
+		n.modifiers = n.modifiers.or(mods)
+		t = target
+	}
+
+	n.src = t
+	return n, nil
+
+}
+
+// The following return the nodes of the types that n's type contains, which
+// when walking an uncompiled type are made as they're reached.
+
+func (v *validator) itemsOf(n *node) (*node, error) {
+	if n.src == nil || n.src.Items == nil {
+		return n.items, nil
+	}
+	return v.visit(n.src.Items)
+}
+
+func (v *validator) elemOf(n *node, i int) (*node, error) {
+	if n.src == nil {
+		return n.elems[i], nil
+	}
+	return v.visit(n.src.Elements[i])
+}
+
+func (v *validator) valuesOf(n *node) (*node, error) {
+	if n.src == nil {
+		return n.values, nil
+	}
+	return v.visit(n.src.Values)
+}
+
+func (v *validator) altOf(n *node, i int) (*node, error) {
+	if n.src == nil {
+		return n.alts[i], nil
+	}
+	return v.visit(n.src.Alternatives[i])
+}
+
+// validate checks that the Decoder holds exactly one JSON value with the
+// structure described by n, and returns the failures found.
+func (v *validator) validate(n *node) error {
+
+	err := v.validateValue(n)
+	if _, ok := err.(*ValidationError); err != nil && !ok {
+		return err
+	}
+	if len(v.errs) == 0 {
+		return nil
+	}
+
+	if !v.opts.AllErrors {
+		return v.errs[0]
+	}
+	return ValidationErrors(v.errs)
+
+}
+
+func (v *validator) validateValue(n *node) error {
 
 	// assert that the next json object matches the type
-	if ok := valid(d, t); !ok {
-		return false
+	if err := v.valid(n); err != nil {
+		return err
 	}
 
 	// assert that all data has been parsed
-	if _, err := d.Token(); err != io.EOF {
-		return false
+	tok, err := v.d.Token()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return v.malformed(n, err)
+	}
+
+	return v.fail(TrailingData, n.kind, jsonType(tok))
+
+}
+
+// valid checks whether the next JSON value in the Decoder has the structure
+// described by n. Values nested too deeply, as they can be for recursive
+// types, are reported and skipped.
+func (v *validator) valid(n *node) error {
+
+	if v.depth == v.maxDepth {
+		return v.tooDeep(n)
 	}
 
-	return true
+	v.depth++
+	err := v.validValue(n)
+	v.depth--
+	return err
+
 }
 
-// valid indicates whether the next JSON value in the Decoder has the structure
-// described by t.
-func valid(d *json.Decoder, t Type) bool {
+// validValue is like valid, but doesn't limit the depth.
+func (v *validator) validValue(n *node) error {
+
+	if n.kind == Union {
+		return v.validUnion(n)
+	}
 
-	switch t.Kind {
+	tok, err := v.d.Token()
+	if err != nil {
+		if n.omittable && err == io.EOF {
+			// no token at all, but it may be omitted so that's okay
+			return nil
+		}
+		return v.malformed(n, err)
+	}
+
+	// a nullable value may always be null
+	if tok == nil && n.nullable {
+		return nil
+	}
+
+	switch n.kind {
 	case String:
-		if ok := validString(d, t); !ok {
-			return false
+		if s, ok := tok.(string); ok {
+			return v.validString(n, s)
 		}
 	case Number:
-		if ok := validNumber(d, t); !ok {
-			return false
+		if num, ok := tok.(json.Number); ok {
+			return v.validNumber(n, num)
+		}
+	case Integer:
+		if num, ok := tok.(json.Number); ok {
+			if d, ok := parseDecimal(num); ok && d.isInteger() {
+				return v.validNumber(n, num)
+			}
 		}
 	case Boolean:
-		if ok := validBoolean(d, t); !ok {
-			return false
+		if _, ok := tok.(bool); ok {
+			return nil
 		}
 	case Null:
-		if ok := validNull(d, t); !ok {
-			return false
+		if tok == nil {
+			return nil
 		}
 	case Array:
-		if ok := validArray(d, t); !ok {
-			return false
+		if tok == json.Delim('[') {
+			return v.validArray(n)
+		}
+	case Tuple:
+		if tok == json.Delim('[') {
+			return v.validTuple(n)
+		}
+	case Map:
+		if tok == json.Delim('{') {
+			return v.validMap(n)
 		}
 	case Object:
-		if ok := validObject(d, t); !ok {
-			return false
+		if tok == json.Delim('{') {
+			return v.validObject(n)
 		}
-	default:
-		return false
+	case Literal:
+		return v.validLiteral(n, tok)
+	case Any:
+		// any value will do, however deeply nested
+		return v.skipValue(n, tok)
+	}
+
+	if err := v.fail(TypeMismatch, n.kind, jsonType(tok)); err != nil {
+		return err
 	}
+	return v.skipValue(n, tok)
 
-	return true
 }
 
-// validString indicates whether the next token in the JSON is a valid string.
-func validString(d *json.Decoder, t Type) bool {
+// validString checks the string s against the format and constraints of n,
+// if any. Lengths are counted in characters rather than bytes.
+func (v *validator) validString(n *node, s string) error {
 
-	tok, err := d.Token()
-	if err != nil {
-		if t.Optional && err == io.EOF {
-			// no token at all, but it's optional so that's okay
-			return true
+	if n.format != nil && !n.format(s) {
+		detail := fmt.Sprintf("%s is not a valid %s", tokenText(s), n.formatName)
+		if err := v.failDetail(InvalidFormat, String, "string", detail); err != nil {
+			return err
 		}
-		log.Printf("validation failed: string: got error: %s\n", err)
-		return false
 	}
 
-	switch tok.(type) {
+	l := n.limits
+	if l == nil {
+		return nil
+	}
+
+	if l.MinLength != nil || l.MaxLength != nil {
+		length := utf8.RuneCountInString(s)
+		if l.MinLength != nil && length < *l.MinLength {
+			if err := v.violation(n, "string", "expected at least %d characters but got %d", *l.MinLength, length); err != nil {
+				return err
+			}
+		}
+		if l.MaxLength != nil && length > *l.MaxLength {
+			if err := v.violation(n, "string", "expected at most %d characters but got %d", *l.MaxLength, length); err != nil {
+				return err
+			}
+		}
+	}
+
+	if l.pattern != nil && !l.pattern.MatchString(s) {
+		return v.violation(n, "string", "%s does not match %s", tokenText(s), l.Pattern)
+	}
+
+	return nil
+
+}
+
+// validNumber checks the number num against the bounds of n, if any.
+func (v *validator) validNumber(n *node, num json.Number) error {
+
+	l := n.limits
+	if l == nil || (l.Min == "" && l.Max == "") {
+		return nil
+	}
+
+	d, _ := parseDecimal(num)
+	if l.Min != "" && d.cmp(l.min) < 0 {
+		return v.violation(n, "number", "expected at least %s but got %s", l.Min, num)
+	}
+	if l.Max != "" && d.cmp(l.max) > 0 {
+		return v.violation(n, "number", "expected at most %s but got %s", l.Max, num)
+	}
+
+	return nil
+
+}
+
+// validLiteral checks whether tok, which has already been read from the
+// Decoder, has the value of the literal n. Numbers are compared by value, so
+// that for instance 2 and 2.0 are equal.
+func (v *validator) validLiteral(n *node, tok json.Token) error {
+
+	switch want := n.value.(type) {
 	case string:
-		return true
-	case nil:
-		if t.Optional {
-			return true
-		} else {
-			log.Println("validation failed: string: got nil for required value")
-			return false
+		if s, ok := tok.(string); ok && s == want {
+			return nil
 		}
-	default:
-		log.Printf("validation failed: string: unexpected type %T: %v\n", tok, tok)
-		return false
+	case decimal:
+		if num, ok := tok.(json.Number); ok {
+			if d, ok := parseDecimal(num); ok && d.cmp(want) == 0 {
+				return nil
+			}
+		}
+	}
+
+	detail := fmt.Sprintf("expected %s but got %s", n.literal, tokenText(tok))
+	if err := v.failDetail(LiteralMismatch, Literal, jsonType(tok), detail); err != nil {
+		return err
 	}
+	return v.skipValue(n, tok)
 
 }
 
-// validNumber indicates whether the next token in the JSON is a valid number.
-func validNumber(d *json.Decoder, t Type) bool {
+// validUnion checks whether the next JSON value in the Decoder matches any of
+// the alternatives of n. The Decoder can't be rewound, so the value is read in
+// full and each alternative is tried against a copy of it.
+func (v *validator) validUnion(n *node) error {
 
-	tok, err := d.Token()
-	if err != nil {
-		if t.Optional && err == io.EOF {
-			// no token at all, but it's optional so that's okay
-			return true
+	var raw json.RawMessage
+	if err := v.d.Decode(&raw); err != nil {
+		if n.omittable && err == io.EOF {
+			// no value at all, but it may be omitted so that's okay
+			return nil
 		}
-		log.Printf("validation failed: number: got error: %s\n", err)
-		return false
+		return v.malformed(n, err)
 	}
 
-	switch tok.(type) {
-	case json.Number:
-		return true
-	case nil:
-		if t.Optional {
-			return true
-		} else {
-			log.Println("validation failed: number: got nil for required value")
-			return false
+	// a nullable value may always be null
+	if n.nullable && string(raw) == "null" {
+		return nil
+	}
+
+	// each alternative is validated from the same path and offset, reporting
+	// only the first failure
+	opts := v.opts
+	opts.AllErrors, opts.Reporter = false, nil
+	start := v.base + v.d.InputOffset() - int64(len(raw))
+
+	alts := len(n.alts)
+	if n.src != nil {
+		alts = len(n.src.Alternatives)
+	}
+
+	tried := make([]*ValidationError, 0, alts)
+	for i := 0; i < alts; i++ {
+		alt, err := v.altOf(n, i)
+		if err != nil {
+			return err
 		}
-	default:
-		log.Printf("validation failed: number: unexpected type %T: %v\n", tok, tok)
-		return false
+		sub := newBytesValidator(raw, opts)
+		sub.path = append(sub.path, v.path...)
+		sub.base = start
+		sub.depth = v.depth
+		err = sub.validate(alt)
+		sub.release()
+		if err == nil {
+			return nil
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			return err
+		}
+		tried = append(tried, verr)
 	}
 
+	return v.record(&ValidationError{
+		Path:         v.pointer(),
+		Reason:       NoMatchingAlternative,
+		Expected:     Union,
+		Actual:       rawType(raw),
+		Offset:       v.base + v.d.InputOffset(),
+		Alternatives: tried,
+	})
+
 }
 
-// validBoolean indicates whether the next token in the JSON is a valid boolean.
-func validBoolean(d *json.Decoder, t Type) bool {
+// validArray checks the elements of an array whose opening delimiter has
+// already been consumed from the Decoder, along with any constraints on
+// their number and uniqueness.
+func (v *validator) validArray(n *node) error {
 
-	tok, err := d.Token()
+	items, err := v.itemsOf(n)
 	if err != nil {
-		if t.Optional && err == io.EOF {
-			// no token at all, but it's optional so that's okay
-			return true
+		return err
+	}
+
+	// for unique elements, note the index of each distinct element by its
+	// canonical encoding
+	var elems map[string]int
+	if n.limits != nil && n.limits.UniqueItems && items != nil {
+		elems = make(map[string]int)
+	}
+
+	i := 0
+	for ; v.d.More(); i++ {
+
+		v.pushIndex(i)
+
+		if items == nil {
+			tok, err := v.d.Token()
+			if err != nil {
+				return v.malformed(n, err)
+			}
+			if err := v.fail(NonEmptyArray, Array, jsonType(tok)); err != nil {
+				return err
+			}
+
+			// the array is reported once, so skip the rest of it
+			v.pop()
+			if err := v.skipValue(n, tok); err != nil {
+				return err
+			}
+			return v.skip(n, 1)
+		}
+
+		if elems != nil {
+			if err := v.validUnique(n, items, elems, i); err != nil {
+				return err
+			}
+		} else if err := v.valid(items); err != nil {
+			return err
 		}
-		log.Printf("validation failed: boolean: got error: %s\n", err)
-		return false
+
+		v.pop()
+
 	}
 
-	switch tok.(type) {
-	case bool:
-		return true
-	case nil:
-		if t.Optional {
-			return true
-		} else {
-			log.Println("validation failed: boolean: got nil for required value")
-			return false
+	// consume the ending ']'
+	if _, err := v.d.Token(); err != nil {
+		return v.malformed(n, err)
+	}
+
+	if l := n.limits; l != nil {
+		if l.MinItems != nil && i < *l.MinItems {
+			return v.violation(n, "array", "expected at least %d elements but got %d", *l.MinItems, i)
+		}
+		if l.MaxItems != nil && i > *l.MaxItems {
+			return v.violation(n, "array", "expected at most %d elements but got %d", *l.MaxItems, i)
 		}
-	default:
-		log.Printf("validation failed: boolean: unexpected type %T: %v\n", tok, tok)
-		return false
 	}
 
+	return nil
+
 }
 
-// validNull indicates whether the next token in the JSON is a valid null value.
-func validNull(d *json.Decoder, t Type) bool {
+// validUnique checks the next element of the array n, of type items, which
+// must differ from the elements before it, listed in elems. The Decoder can't
+// be rewound, so the element is read in full and validated from a copy of it.
+func (v *validator) validUnique(n, items *node, elems map[string]int, i int) error {
+
+	var raw json.RawMessage
+	if err := v.d.Decode(&raw); err != nil {
+		return v.malformed(items, err)
+	}
 
-	tok, err := d.Token()
+	// the failures found in the copy are collected with the others
+	sub := newBytesValidator(raw, v.opts)
+	sub.path = append(sub.path, v.path...)
+	sub.base = v.base + v.d.InputOffset() - int64(len(raw))
+	sub.depth = v.depth
+	sub.errs = v.errs
+	err := sub.valid(items)
+	v.errs = sub.errs
+	sub.release()
 	if err != nil {
-		if t.Optional && err == io.EOF {
-			// no token at all, but it's optional so that's okay
-			return true
-		}
-		log.Printf("validation failed: null: got error: %s\n", err)
-		return false
+		return err
 	}
 
-	switch tok.(type) {
-	case nil:
-		return true
-	default:
-		log.Printf("validation failed: null: unexpected type %T: %v\n", tok, tok)
-		return false
+	key := canonical(raw)
+	if j, ok := elems[key]; ok {
+		return v.violation(n, rawType(raw), "duplicate of element %d", j)
 	}
+	elems[key] = i
+	return nil
 
 }
 
-// validArray indicates whether the next token in the JSON is a valid array.
-func validArray(d *json.Decoder, t Type) bool {
+// canonical encodes the JSON value raw such that equal values encode equally,
+// even if their numbers are written differently or their properties are in a
+// different order.
+func canonical(raw json.RawMessage) string {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var val interface{}
+	_ = d.Decode(&val)
+	out, _ := json.Marshal(canonicalValue(val))
+	return string(out)
+}
 
-	tok, err := d.Token()
-	if err != nil {
-		if t.Optional && err == io.EOF {
-			// no token at all, but it's optional so that's okay
-			return true
+// canonicalValue rewrites the numbers in a decoded JSON value in canonical
+// form.
+func canonicalValue(val interface{}) interface{} {
+	switch val := val.(type) {
+	case json.Number:
+		d, _ := parseDecimal(val)
+		return json.Number(d.String())
+	case []interface{}:
+		for i := range val {
+			val[i] = canonicalValue(val[i])
+		}
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = canonicalValue(val[k])
 		}
-		log.Printf("validation failed: array: got error: %s\n", err)
-		return false
 	}
+	return val
+}
+
+// validTuple checks the elements of a tuple whose opening delimiter has
+// already been consumed from the Decoder. Trailing omittable elements may be
+// absent, while any surplus elements are skipped and counted so that the
+// failure can report the tuple's length.
+func (v *validator) validTuple(n *node) error {
 
-	if delim, ok := tok.(json.Delim); !ok || delim != json.Delim('[') {
-		log.Printf("validation failed: array: unexpected delimiter: %s\n", delim)
-		return false
+	count := len(n.elems)
+	if n.src != nil {
+		count = len(n.src.Elements)
 	}
 
-	// schedule the consumption of the ending ']'
-	defer d.Token()
+	i := 0
+	for ; i < count && v.d.More(); i++ {
+		v.pushIndex(i)
+		elem, err := v.elemOf(n, i)
+		if err != nil {
+			return err
+		}
+		if err := v.valid(elem); err != nil {
+			return err
+		}
+		v.pop()
+	}
 
-	for d.More() {
-		if t.Items == nil {
-			log.Println("validation failed: array: array is not empty")
-			return false
+	for ; v.d.More(); i++ {
+		tok, err := v.d.Token()
+		if err != nil {
+			return v.malformed(n, err)
 		}
-		if ok := valid(d, *t.Items); !ok {
-			log.Println("validation failed: array: invalid sub-element")
-			return false
+		if err := v.skipValue(n, tok); err != nil {
+			return err
 		}
 	}
 
-	return true
+	// consume the ending ']'
+	if _, err := v.d.Token(); err != nil {
+		return v.malformed(n, err)
+	}
+
+	if i < n.minElems || i > count {
+		var want string
+		switch {
+		case n.minElems == count:
+			want = strconv.Itoa(n.minElems)
+		case i < n.minElems:
+			want = "at least " + strconv.Itoa(n.minElems)
+		default:
+			want = "at most " + strconv.Itoa(count)
+		}
+		detail := fmt.Sprintf("expected %s elements but got %d", want, i)
+		return v.failDetail(TupleLength, Tuple, "array", detail)
+	}
+
+	return nil
 
 }
 
-// validObject indicates whether the next token in the JSON is a valid object.
-func validObject(d *json.Decoder, t Type) bool {
+// validMap checks the members of a map whose opening delimiter has already
+// been consumed from the Decoder. The value of a key that doesn't match the
+// key pattern is skipped.
+func (v *validator) validMap(n *node) error {
 
-	tok, err := d.Token()
+	values, err := v.valuesOf(n)
 	if err != nil {
-		if t.Optional && err == io.EOF {
-			// no token at all, but it's optional so that's okay
-			return true
+		return err
+	}
+
+	for v.d.More() {
+
+		// parse out a key; the Decoder guarantees that it is a string
+		keyTok, err := v.d.Token()
+		if err != nil {
+			return v.malformed(n, err)
+		}
+		key := keyTok.(string)
+
+		v.pushName(key)
+
+		if n.pattern != nil && !n.pattern.MatchString(key) {
+			detail := fmt.Sprintf("key %s does not match %s", tokenText(key), n.pattern)
+			if err := v.failDetail(InvalidKey, Map, "string", detail); err != nil {
+				return err
+			}
+			tok, err := v.d.Token()
+			if err != nil {
+				return v.malformed(n, err)
+			}
+			if err := v.skipValue(n, tok); err != nil {
+				return err
+			}
+		} else if err := v.valid(values); err != nil {
+			return err
 		}
-		log.Printf("validation failed: object: got error: %s\n", err)
-		return false
+
+		v.pop()
+
 	}
 
-	if delim, ok := tok.(json.Delim); !ok || delim != json.Delim('{') {
-		log.Printf("validation failed: object: unexpected delimiter: %s\n", delim)
-		return false
+	// consume the ending '}'
+	if _, err := v.d.Token(); err != nil {
+		return v.malformed(n, err)
 	}
 
-	// schedule the consumption of the ending '}'
-	defer d.Token()
+	return nil
+
+}
+
+// validObject checks the members of an object whose opening delimiter has
+// already been consumed from the Decoder.
+func (v *validator) validObject(n *node) error {
 
-	// note which properties we need to find
-	necessaryProps := make(map[string]bool)
-	for k := range t.Properties {
-		necessaryProps[k] = true
+	if n.src != nil {
+		return v.walkObject(n)
 	}
 
-	for d.More() {
+	// note which properties we have found, using a bitset indexed like
+	// n.props that only needs allocating for very large objects
+	var small [1]uint64
+	seen := small[:]
+	if len(n.props) > 64 {
+		seen = make([]uint64, (len(n.props)+63)/64)
+	}
+	found := 0 // the number of distinct required properties found
+
+	for v.d.More() {
 
-		// parse out a key
-		keyTok, err := d.Token()
+		// parse out a key; the Decoder guarantees that it is a string
+		keyTok, err := v.d.Token()
 		if err != nil {
-			log.Printf("validation failed: object: failed to read key: %s\n", err)
-			return false
+			return v.malformed(n, err)
 		}
+		key := keyTok.(string)
+
+		v.pushName(key)
+
+		// look up the type for this property, skipping the values of
+		// undeclared properties
+		i, ok := n.lookup(key)
+		if !ok {
+			if err := v.undeclared(n); err != nil {
+				return err
+			}
+			v.pop()
+			continue
+		}
+
+		// mark this property as visited
+		prop := n.props[i].node
+		if word, bit := i/64, uint64(1)<<uint(i%64); seen[word]&bit == 0 {
+			seen[word] |= bit
+			if !prop.omittable {
+				found++
+			}
+		}
+
+		if err := v.valid(prop); err != nil {
+			return err
+		}
+
+		v.pop()
+
+	}
+
+	// consume the ending '}'
+	if _, err := v.d.Token(); err != nil {
+		return v.malformed(n, err)
+	}
+
+	if found == n.required {
+		return nil
+	}
+
+	// report the not-located properties that may not be omitted
+	for i, prop := range n.props {
+		if seen[i/64]&(uint64(1)<<uint(i%64)) != 0 || prop.node.omittable {
+			continue
+		}
+		v.pushName(prop.name)
+		if err := v.fail(MissingProperty, prop.node.kind, ""); err != nil {
+			return err
+		}
+		v.pop()
+	}
+
+	return nil
+
+}
+
+// walkObject is like validObject, but for an object type that hasn't been
+// compiled. Rather than being indexed, its properties are looked up by name,
+// and those found noted in a set.
+func (v *validator) walkObject(n *node) error {
 
-		// it better be a string
-		keyTokStr, keyOk := keyTok.(string)
-		if !keyOk {
-			log.Printf("validation failed: object: non-string key: %s\n", keyTok)
-			return false
+	seen := make(map[string]bool)
+	found := 0 // the number of distinct required properties found
+
+	for v.d.More() {
+
+		// parse out a key; the Decoder guarantees that it is a string
+		keyTok, err := v.d.Token()
+		if err != nil {
+			return v.malformed(n, err)
 		}
+		key := keyTok.(string)
 
-		// look up the type for this property
-		propType, ok := t.Properties[keyTokStr]
+		v.pushName(key)
+
+		// look up the type for this property, skipping the values of
+		// undeclared properties
+		pt, ok := n.src.Properties[key]
 		if !ok {
-			log.Printf("validation failed: object: contains undeclared property %q\n", keyTokStr)
-			return false
+			if err := v.undeclared(n); err != nil {
+				return err
+			}
+			v.pop()
+			continue
+		}
+
+		prop, err := v.visit(pt)
+		if err != nil {
+			return err
 		}
 
 		// mark this property as visited
-		delete(necessaryProps, keyTokStr)
+		if !seen[key] {
+			seen[key] = true
+			if !prop.omittable {
+				found++
+			}
+		}
+
+		if err := v.valid(prop); err != nil {
+			return err
+		}
+
+		v.pop()
+
+	}
+
+	// consume the ending '}'
+	if _, err := v.d.Token(); err != nil {
+		return v.malformed(n, err)
+	}
+
+	if found == n.required {
+		return nil
+	}
+
+	// report the not-located properties that may not be omitted, in the
+	// same order as for a compiled type
+	names := make([]string, 0, len(n.src.Properties))
+	for name := range n.src.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		prop, err := v.visit(n.src.Properties[name])
+		if err != nil {
+			return err
+		}
+		if prop.omittable {
+			continue
+		}
+		v.pushName(name)
+		if err := v.fail(MissingProperty, prop.kind, ""); err != nil {
+			return err
+		}
+		v.pop()
+	}
+
+	return nil
+
+}
+
+// undeclared reports the value of an undeclared property of the object n,
+// unless undeclared properties are permitted, and skips it.
+func (v *validator) undeclared(n *node) error {
+
+	tok, err := v.d.Token()
+	if err != nil {
+		return v.malformed(n, err)
+	}
 
-		if ok := valid(d, *propType); !ok {
-			log.Println("validation failed: object: invalid sub-element")
-			return false
+	if !n.open && !v.opts.OpenObjects {
+		if err := v.fail(UndeclaredProperty, Object, jsonType(tok)); err != nil {
+			return err
 		}
 	}
 
-	// make sure that any not-located properties were optional
-	for k := range necessaryProps {
-		if opt := t.Properties[k].Optional; !opt {
-			log.Printf("validation failed: object: missing required property: %q\n", k)
-			return false
+	return v.skipValue(n, tok)
+
+}
+
+func (v *validator) pushName(name string) { v.path = append(v.path, segment{name: name, index: -1}) }
+
+func (v *validator) pushIndex(i int) { v.path = append(v.path, segment{index: i}) }
+
+func (v *validator) pop() { v.path = v.path[:len(v.path)-1] }
+
+// pointer renders the current path as a JSON Pointer.
+func (v *validator) pointer() string {
+	var buf bytes.Buffer
+	for _, seg := range v.path {
+		buf.WriteByte('/')
+		if seg.index >= 0 {
+			buf.WriteString(strconv.Itoa(seg.index))
+		} else {
+			buf.WriteString(pointerEscaper.Replace(seg.name))
 		}
 	}
+	return buf.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
 
-	return true
+// skipValue consumes the remainder of the JSON value beginning with tok,
+// which has already been read from the Decoder.
+func (v *validator) skipValue(n *node, tok json.Token) error {
+	if tok == json.Delim('{') || tok == json.Delim('[') {
+		return v.skip(n, 1)
+	}
+	return nil
+}
 
+// skip consumes tokens from the Decoder until depth currently open arrays or
+// objects have been closed.
+func (v *validator) skip(n *node, depth int) error {
+	for depth > 0 {
+		tok, err := v.d.Token()
+		if err != nil {
+			return v.malformed(n, err)
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// fail records a ValidationError for the value at the current path, and
+// returns it if validation must stop as a result.
+func (v *validator) fail(reason Reason, expected Kind, actual string) error {
+	return v.failDetail(reason, expected, actual, "")
+}
+
+// violation records a ConstraintViolation for the value at the current path,
+// explaining it with the formatted detail.
+func (v *validator) violation(n *node, actual, format string, args ...interface{}) error {
+	return v.failDetail(ConstraintViolation, n.kind, actual, fmt.Sprintf(format, args...))
+}
+
+// failDetail is like fail, but also explains the failure in detail.
+func (v *validator) failDetail(reason Reason, expected Kind, actual, detail string) error {
+	return v.record(&ValidationError{
+		Path:     v.pointer(),
+		Reason:   reason,
+		Expected: expected,
+		Actual:   actual,
+		Detail:   detail,
+		Offset:   v.base + v.d.InputOffset(),
+	})
+}
+
+// tooDeep records a ValidationError for a value that is nested more deeply
+// than allowed, and skips the value.
+func (v *validator) tooDeep(n *node) error {
+
+	tok, err := v.d.Token()
+	if err != nil {
+		return v.malformed(n, err)
+	}
+
+	detail := fmt.Sprintf("%s nested more than %d deep", jsonType(tok), v.maxDepth)
+	if err := v.failDetail(TooDeep, n.kind, jsonType(tok), detail); err != nil {
+		return err
+	}
+	return v.skipValue(n, tok)
+
+}
+
+// malformed records a ValidationError for a failure to read the next token,
+// which always stops validation. Running out of input is reported as a type
+// mismatch, since it can only happen where a top-level value was expected.
+func (v *validator) malformed(n *node, err error) error {
+	verr := &ValidationError{
+		Path:     v.pointer(),
+		Reason:   MalformedJSON,
+		Expected: n.kind,
+		Offset:   v.base + v.d.InputOffset(),
+		Err:      err,
+	}
+	if err == io.EOF {
+		verr.Reason, verr.Actual, verr.Err = TypeMismatch, "end of input", nil
+	}
+	v.record(verr)
+	return verr
+}
+
+func (v *validator) record(err *ValidationError) error {
+	if v.opts.Reporter != nil {
+		v.opts.Reporter.Report(err)
+	}
+	v.errs = append(v.errs, err)
+	if !v.opts.AllErrors || (v.opts.MaxErrors > 0 && len(v.errs) >= v.opts.MaxErrors) {
+		return err
+	}
+	return nil
+}
+
+// jsonType names the JSON type of the value beginning with tok.
+func jsonType(tok json.Token) string {
+	switch tok {
+	case nil:
+		return "null"
+	case json.Delim('{'):
+		return "object"
+	case json.Delim('['):
+		return "array"
+	}
+	switch tok.(type) {
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%v", tok)
+}
+
+// rawType names the JSON type of the encoded value raw.
+func rawType(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "end of input"
+	}
+	switch raw[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// tokenText renders a scalar token as JSON, or otherwise names its type.
+func tokenText(tok json.Token) string {
+	switch tok := tok.(type) {
+	case string:
+		return quote(tok)
+	case json.Number:
+		return string(tok)
+	}
+	return jsonType(tok)
 }
@@ -2,6 +2,10 @@ package jstn
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -58,6 +62,67 @@ func TestValid(t *testing.T) {
 			Valid:    true,
 		},
 
+		// Integers are whole numbers in any notation, however large.
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`10`),
+			Valid:    true,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`-7`),
+			Valid:    true,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`1e3`),
+			Valid:    true,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`2.0`),
+			Valid:    true,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`0`),
+			Valid:    true,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`9007199254740993`),
+			Valid:    true,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`1.5`),
+			Valid:    false,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`1e-3`),
+			Valid:    false,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`9007199254740993.5`),
+			Valid:    false,
+		},
+
+		{
+			Type:     Type{Kind: Integer, Optional: false},
+			TestData: json.RawMessage(`"1"`),
+			Valid:    false,
+		},
+
 		{
 			Type:     Type{Kind: Boolean, Optional: false},
 			TestData: json.RawMessage(`true`),
@@ -187,6 +252,825 @@ func TestValid(t *testing.T) {
 
 }
 
+func TestValidate(t *testing.T) {
+
+	schema := MustParse(`{
+	author: string
+	works: [{
+		title: string
+		year: number?
+	}]
+	tags: []?
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{
+			TestData: `{"author":"Goethe","works":[{"title":"Faust","year":1808}]}`,
+			Error:    nil,
+		},
+		{
+			TestData: `{"author":"Goethe","works":[{"title":"Faust"},{"title":7}]}`,
+			Error:    &ValidationError{Path: "/works/1/title", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 56},
+		},
+		{
+			TestData: `{"author":"Goethe","works":[{"year":1808}]}`,
+			Error:    &ValidationError{Path: "/works/0/title", Reason: MissingProperty, Expected: String, Offset: 41},
+		},
+		{
+			TestData: `{"author":"Goethe","works":[],"a/b~c":{}}`,
+			Error:    &ValidationError{Path: "/a~1b~0c", Reason: UndeclaredProperty, Expected: Object, Actual: "object", Offset: 39},
+		},
+		{
+			TestData: `{"author":"Goethe","works":[],"tags":["poet"]}`,
+			Error:    &ValidationError{Path: "/tags/0", Reason: NonEmptyArray, Expected: Array, Actual: "string", Offset: 44},
+		},
+		{
+			TestData: `{"author":"Goethe","works":[]} true`,
+			Error:    &ValidationError{Path: "", Reason: TrailingData, Expected: Object, Actual: "boolean", Offset: 35},
+		},
+		{
+			TestData: ``,
+			Error:    &ValidationError{Path: "", Reason: TypeMismatch, Expected: Object, Actual: "end of input"},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected %#v but got %#v", i, c.Error, err)
+		}
+
+	}
+
+}
+
+func TestValidate_Malformed(t *testing.T) {
+
+	err := Validate(Type{Kind: Array, Items: &Type{Kind: Number}}, []byte(`[1, 2,`))
+
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a *ValidationError but got %#v", err)
+	}
+
+	if verr.Reason != MalformedJSON || verr.Err == nil {
+		t.Errorf("unexpected validation error: %#v", verr)
+	}
+
+}
+
+func TestValidateAll(t *testing.T) {
+
+	schema := MustParse(`{
+	author: string
+	works: [{
+		title: string
+		year: number?
+	}]
+	tags: []?
+}`)
+
+	doc := []byte(`{
+	"author": 17,
+	"works": [
+		{"title": {"nested": [1, 2]}, "year": 1808},
+		{"year": "1773", "extra": [{"a": 1}]},
+		{"title": "Faust"}
+	],
+	"tags": [[1], 2, {"x": 3}]
+}`)
+
+	expected := ValidationErrors{
+		{Path: "/author", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 15},
+		{Path: "/works/0/title", Reason: TypeMismatch, Expected: String, Actual: "object", Offset: 42},
+		{Path: "/works/1/year", Reason: TypeMismatch, Expected: Number, Actual: "string", Offset: 93},
+		{Path: "/works/1/extra", Reason: UndeclaredProperty, Expected: Object, Actual: "array", Offset: 105},
+		{Path: "/works/1/title", Reason: MissingProperty, Expected: String, Offset: 115},
+		{Path: "/tags/0", Reason: NonEmptyArray, Expected: Array, Actual: "array", Offset: 153},
+	}
+
+	err := ValidateAll(schema, doc, 0)
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("unexpected validation errors: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+	// the number of errors collected may be capped
+	err = ValidateAll(schema, doc, 2)
+	if !reflect.DeepEqual(err, expected[:2]) {
+		t.Errorf("unexpected capped validation errors: expected\n%s\nbut got\n%v", expected[:2], err)
+	}
+
+	if err := ValidateAll(schema, []byte(`{"author":"Goethe","works":[]}`), 0); err != nil {
+		t.Errorf("unexpected validation errors: %s", err)
+	}
+
+}
+
+func TestValidate_Union(t *testing.T) {
+
+	schema := MustParse(`{
+	id: string | number
+	owner: {name: string} | {id: number} | null
+	tags: [string | [string]]?
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"id":"a1","owner":{"name":"x"}}`},
+		{TestData: `{"id":7,"owner":{"id":3},"tags":["a",["b","c"]]}`},
+		{TestData: `{"id":7,"owner":null,"tags":null}`},
+		{
+			TestData: `{"id":true,"owner":null}`,
+			Error: &ValidationError{Path: "/id", Reason: NoMatchingAlternative, Expected: Union, Actual: "boolean", Offset: 10, Alternatives: []*ValidationError{
+				{Path: "/id", Reason: TypeMismatch, Expected: String, Actual: "boolean", Offset: 10},
+				{Path: "/id", Reason: TypeMismatch, Expected: Number, Actual: "boolean", Offset: 10},
+			}},
+		},
+		{
+			TestData: `{"id":1,"owner":{"name":2}}`,
+			Error: &ValidationError{Path: "/owner", Reason: NoMatchingAlternative, Expected: Union, Actual: "object", Offset: 26, Alternatives: []*ValidationError{
+				{Path: "/owner/name", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 25},
+				{Path: "/owner/name", Reason: UndeclaredProperty, Expected: Object, Actual: "number", Offset: 25},
+				{Path: "/owner", Reason: TypeMismatch, Expected: Null, Actual: "object", Offset: 17},
+			}},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%s\nbut got\n%v", i, c.Error, err)
+		}
+
+	}
+
+	// the message lists the failure for each alternative tried
+	err := Validate(schema, []byte(`{"id":1,"owner":{"name":2}}`))
+	expected := `jstn: /owner: object matches no alternative (/owner/name: expected string but got number; /owner/name: undeclared property of type number; expected null but got object)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected message: expected %q but got %v", expected, err)
+	}
+
+}
+
+func TestValidate_Nullable(t *testing.T) {
+
+	schema := MustParse(`type Node = {name: string; next?: Node; prev: Node | null}
+{
+	nickname?: string
+	manager: string | null
+	legacy: string?
+	node?: Node
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"manager":null}`},
+		{TestData: `{"nickname":"x","manager":"y","legacy":null}`},
+		{TestData: `{"manager":"y","node":{"name":"a","prev":null,"next":{"name":"b","prev":{"name":"c","prev":null}}}}`},
+		{
+			TestData: `{"nickname":null,"manager":"y"}`,
+			Error:    &ValidationError{Path: "/nickname", Reason: TypeMismatch, Expected: String, Actual: "null", Offset: 16},
+		},
+		{
+			TestData: `{"nickname":"x"}`,
+			Error:    &ValidationError{Path: "/manager", Reason: MissingProperty, Expected: String, Offset: 16},
+		},
+		{
+			TestData: `{"manager":null,"node":{"name":"a","prev":null,"next":null}}`,
+			Error:    &ValidationError{Path: "/node/next", Reason: TypeMismatch, Expected: Object, Actual: "null", Offset: 58},
+		},
+		{
+			TestData: `{"manager":null,"node":{"name":"a"}}`,
+			Error:    &ValidationError{Path: "/node/prev", Reason: MissingProperty, Expected: Object, Offset: 35},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%#v\nbut got\n%#v", i, c.Error, err)
+		}
+
+	}
+
+}
+
+func TestValidate_Any(t *testing.T) {
+
+	schema := MustParse(`{
+	id: string
+	metadata: any
+	extra: object?
+	tags: array
+}`)
+
+	// any value is skipped in full, however deeply it is nested
+	deep := strings.Repeat(`{"a":[`, 2000) + strings.Repeat(`]}`, 2000)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"id":"a","metadata":null,"tags":[]}`},
+		{TestData: `{"id":"a","metadata":{"x":[1,{"y":[true,"z"]}],"w":{}},"extra":{"k":[null]},"tags":[1,"b",[{}]]}`},
+		{TestData: `{"id":"a","metadata":` + deep + `,"tags":[` + deep + `]}`},
+		{
+			TestData: `{"id":"a","metadata":[{"x":1}],"extra":[],"tags":[]}`,
+			Error:    &ValidationError{Path: "/extra", Reason: TypeMismatch, Expected: Object, Actual: "array", Offset: 40},
+		},
+		{
+			TestData: `{"id":"a","tags":{}}`,
+			Error:    &ValidationError{Path: "/tags", Reason: TypeMismatch, Expected: Array, Actual: "object", Offset: 18},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%#v\nbut got\n%#v", i, c.Error, err)
+		}
+
+	}
+
+	// a value skipped must still be well formed
+	err := Validate(schema, []byte(`{"id":"a","metadata":{"x":[1,}]},"tags":[]}`))
+	if verr, ok := err.(*ValidationError); !ok || verr.Reason != MalformedJSON || verr.Path != "/metadata" {
+		t.Errorf("unexpected validation error: %#v", err)
+	}
+
+}
+
+func TestValidate_Constraints(t *testing.T) {
+
+	schema := MustParse(`{
+	age: integer(min=0, max=150)?
+	ratio: number(min=-1, max=1e0)?
+	name: string(minLength=1, maxLength=4, pattern="^[a-zé]+$")?
+	tags: [string](minItems=1, maxItems=3)?
+	points: [[number]](uniqueItems)?
+	objects: array(uniqueItems)?
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{}`},
+		{TestData: `{"age":0,"ratio":-1.0,"name":"café","tags":["a"],"points":[[1],[1,2],[2,1]],"objects":[{"a":1,"b":2},{"a":1}]}`},
+		{TestData: `{"age":150.0,"ratio":10e-1,"name":"a","tags":["a","a","a"],"points":[],"objects":[1,"1",[1],null]}`},
+		{
+			TestData: `{"age":-4}`,
+			Error:    &ValidationError{Path: "/age", Reason: ConstraintViolation, Expected: Integer, Actual: "number", Detail: "expected at least 0 but got -4", Offset: 9},
+		},
+		{
+			TestData: `{"ratio":1.0001}`,
+			Error:    &ValidationError{Path: "/ratio", Reason: ConstraintViolation, Expected: Number, Actual: "number", Detail: "expected at most 1e0 but got 1.0001", Offset: 15},
+		},
+		{
+			TestData: `{"name":""}`,
+			Error:    &ValidationError{Path: "/name", Reason: ConstraintViolation, Expected: String, Actual: "string", Detail: "expected at least 1 characters but got 0", Offset: 10},
+		},
+		{
+			TestData: `{"name":"cafés"}`,
+			Error:    &ValidationError{Path: "/name", Reason: ConstraintViolation, Expected: String, Actual: "string", Detail: "expected at most 4 characters but got 5", Offset: 16},
+		},
+		{
+			TestData: `{"name":"Bob"}`,
+			Error:    &ValidationError{Path: "/name", Reason: ConstraintViolation, Expected: String, Actual: "string", Detail: `"Bob" does not match ^[a-zé]+$`, Offset: 13},
+		},
+		{
+			TestData: `{"tags":[]}`,
+			Error:    &ValidationError{Path: "/tags", Reason: ConstraintViolation, Expected: Array, Actual: "array", Detail: "expected at least 1 elements but got 0", Offset: 10},
+		},
+		{
+			TestData: `{"tags":["a","b","c","d"]}`,
+			Error:    &ValidationError{Path: "/tags", Reason: ConstraintViolation, Expected: Array, Actual: "array", Detail: "expected at most 3 elements but got 4", Offset: 25},
+		},
+		{
+			TestData: `{"points":[[1,2],[3],[1.0,20e-1]]}`,
+			Error:    &ValidationError{Path: "/points/2", Reason: ConstraintViolation, Expected: Array, Actual: "array", Detail: "duplicate of element 0", Offset: 32},
+		},
+		{
+			TestData: `{"objects":[{"a":[1,{"b":null}],"c":"d"},{"c":"d","a":[1,{"b":null}]}]}`,
+			Error:    &ValidationError{Path: "/objects/1", Reason: ConstraintViolation, Expected: Array, Actual: "object", Detail: "duplicate of element 0", Offset: 69},
+		},
+		{
+			TestData: `{"points":[[1],["x"]]}`,
+			Error:    &ValidationError{Path: "/points/1/0", Reason: TypeMismatch, Expected: Number, Actual: "string", Offset: 19},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%#v\nbut got\n%#v", i, c.Error, err)
+		}
+
+	}
+
+	// every violation is reported, including those in unique elements
+	err := ValidateAll(schema, []byte(`{"name":"ABCDE","points":[["x"],["x"]]}`), 0)
+	expected := `jstn: /name: expected at most 4 characters but got 5
+jstn: /name: "ABCDE" does not match ^[a-zé]+$
+jstn: /points/0/0: expected number but got string
+jstn: /points/1/0: expected number but got string
+jstn: /points/1: duplicate of element 0`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected errors: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+}
+
+func TestValidate_Format(t *testing.T) {
+
+	schema := MustParse(`{
+	id: string<uuid>
+	created: string<date-time>(pattern="Z$")?
+	contact: [string<email>]?
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"id":"123e4567-e89b-12d3-a456-426614174000"}`},
+		{TestData: `{"id":"123e4567-e89b-12d3-a456-426614174000","created":"2006-01-02T15:04:05Z","contact":["a@example.com"]}`},
+		{
+			TestData: `{"id":"123"}`,
+			Error:    &ValidationError{Path: "/id", Reason: InvalidFormat, Expected: String, Actual: "string", Detail: `"123" is not a valid uuid`, Offset: 11},
+		},
+		{
+			TestData: `{"id":12}`,
+			Error:    &ValidationError{Path: "/id", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 8},
+		},
+		{
+			TestData: `{"id":"123e4567-e89b-12d3-a456-426614174000","contact":["a@example.com","b"]}`,
+			Error:    &ValidationError{Path: "/contact/1", Reason: InvalidFormat, Expected: String, Actual: "string", Detail: `"b" is not a valid email`, Offset: 75},
+		},
+		{
+			TestData: `{"id":"123e4567-e89b-12d3-a456-426614174000","contact":["A & B <ab@example.com>"]}`,
+			Error:    &ValidationError{Path: "/contact/0", Reason: InvalidFormat, Expected: String, Actual: "string", Detail: `"A & B <ab@example.com>" is not a valid email`, Offset: 80},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%#v\nbut got\n%#v", i, c.Error, err)
+		}
+
+	}
+
+	// a string may have the wrong format and violate a constraint too
+	err := ValidateAll(schema, []byte(`{"id":"123e4567-e89b-12d3-a456-426614174000","created":"yesterday"}`), 0)
+	expected := `jstn: /created: "yesterday" is not a valid date-time
+jstn: /created: "yesterday" does not match Z$`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected errors: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+}
+
+func TestValidate_Literal(t *testing.T) {
+
+	schema := MustParse(`{
+	status: "active" | "suspended" | "deleted"
+	version: 2
+	label: "caf\u00e9"?
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"status":"active","version":2}`},
+		{TestData: `{"status":"deleted","version":2.0,"label":"café"}`},
+		{TestData: `{"status":"suspended","version":20e-1,"label":null}`},
+		{
+			TestData: `{"status":"active","version":3}`,
+			Error:    &ValidationError{Path: "/version", Reason: LiteralMismatch, Expected: Literal, Actual: "number", Detail: "expected 2 but got 3", Offset: 30},
+		},
+		{
+			TestData: `{"status":"active","version":"2"}`,
+			Error:    &ValidationError{Path: "/version", Reason: LiteralMismatch, Expected: Literal, Actual: "string", Detail: `expected 2 but got "2"`, Offset: 32},
+		},
+		{
+			TestData: `{"status":"active","version":2,"label":{}}`,
+			Error:    &ValidationError{Path: "/label", Reason: LiteralMismatch, Expected: Literal, Actual: "object", Detail: `expected "caf\u00e9" but got object`, Offset: 40},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%s\nbut got\n%v", i, c.Error, err)
+		}
+
+	}
+
+	// the message names the alternatives tried
+	err := Validate(schema, []byte(`{"status":"gone","version":2}`))
+	expected := `jstn: /status: string matches no alternative (expected "active" but got "gone"; expected "suspended" but got "gone"; expected "deleted" but got "gone")`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected message: expected %q but got %v", expected, err)
+	}
+
+}
+
+func TestValidate_Tuple(t *testing.T) {
+
+	schema := MustParse(`{
+	point: [number, number, string?, boolean?]
+	pair: [string?, number]?
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"point":[1,2]}`},
+		{TestData: `{"point":[1,2,"a"],"pair":[null,3]}`},
+		{TestData: `{"point":[1,2,null,true],"pair":null}`},
+		{
+			TestData: `{"point":[1,"2"]}`,
+			Error:    &ValidationError{Path: "/point/1", Reason: TypeMismatch, Expected: Number, Actual: "string", Offset: 15},
+		},
+		{
+			TestData: `{"point":[1]}`,
+			Error:    &ValidationError{Path: "/point", Reason: TupleLength, Expected: Tuple, Actual: "array", Detail: "expected at least 2 elements but got 1", Offset: 12},
+		},
+		{
+			TestData: `{"point":[1,2,"a",true,[3],{"b":4}]}`,
+			Error:    &ValidationError{Path: "/point", Reason: TupleLength, Expected: Tuple, Actual: "array", Detail: "expected at most 4 elements but got 6", Offset: 35},
+		},
+		{
+			TestData: `{"point":[1,2],"pair":["a"]}`,
+			Error:    &ValidationError{Path: "/pair", Reason: TupleLength, Expected: Tuple, Actual: "array", Detail: "expected 2 elements but got 1", Offset: 27},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%s\nbut got\n%v", i, c.Error, err)
+		}
+
+	}
+
+	// validation continues after a tuple of the wrong length
+	err := ValidateAll(schema, []byte(`{"point":[1,2,"a",true,5],"pair":[1,2]}`), 0)
+	expected := ValidationErrors{
+		{Path: "/point", Reason: TupleLength, Expected: Tuple, Actual: "array", Detail: "expected at most 4 elements but got 5", Offset: 25},
+		{Path: "/pair/0", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 35},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("unexpected validation errors: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+}
+
+func TestValidate_Map(t *testing.T) {
+
+	schema := MustParse(`{
+	scores: {[string]: number?}
+	labels: {["^[a-z]+$"]: [string]}?
+}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"scores":{}}`},
+		{TestData: `{"scores":{"alice":1,"bob":null,"~/":3},"labels":{"en":["x"],"fr":[]}}`},
+		{
+			TestData: `{"scores":{"alice":1,"a/b":"2"}}`,
+			Error:    &ValidationError{Path: "/scores/a~1b", Reason: TypeMismatch, Expected: Number, Actual: "string", Offset: 30},
+		},
+		{
+			TestData: `{"scores":{},"labels":{"en":[],"EN":[1]}}`,
+			Error:    &ValidationError{Path: "/labels/EN", Reason: InvalidKey, Expected: Map, Actual: "string", Detail: `key "EN" does not match ^[a-z]+$`, Offset: 35},
+		},
+		{
+			TestData: `{"scores":[]}`,
+			Error:    &ValidationError{Path: "/scores", Reason: TypeMismatch, Expected: Map, Actual: "array", Offset: 11},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%s\nbut got\n%v", i, c.Error, err)
+		}
+
+	}
+
+	// the value of an invalid key is skipped
+	err := ValidateAll(schema, []byte(`{"scores":{},"labels":{"EN":[1],"en":[2]}}`), 0)
+	expected := ValidationErrors{
+		{Path: "/labels/EN", Reason: InvalidKey, Expected: Map, Actual: "string", Detail: `key "EN" does not match ^[a-z]+$`, Offset: 27},
+		{Path: "/labels/en/0", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 39},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("unexpected validation errors: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+}
+
+func TestValidate_Open(t *testing.T) {
+
+	schema := MustParse(`{
+	id: string
+	meta: {
+		version: number
+		...
+	}
+}`)
+
+	// undeclared properties of an open object are skipped, however nested
+	doc := []byte(`{"id":"a","meta":{"version":1,"extra":{"x":[1,{"y":2}]},"more":true}}`)
+	if err := Validate(schema, doc); err != nil {
+		t.Errorf("unexpected validation error: %s", err)
+	}
+
+	// declared properties are still checked
+	err := Validate(schema, []byte(`{"id":"a","meta":{"extra":[],"version":"1"}}`))
+	expected := &ValidationError{Path: "/meta/version", Reason: TypeMismatch, Expected: Number, Actual: "string", Offset: 42}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("unexpected validation error: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+	// other objects remain closed, unless every object is made open
+	doc = []byte(`{"id":"a","meta":{"version":1},"other":{}}`)
+	err = Validate(schema, doc)
+	expected = &ValidationError{Path: "/other", Reason: UndeclaredProperty, Expected: Object, Actual: "object", Offset: 40}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("unexpected validation error: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+	if err := (ValidatorOptions{OpenObjects: true}).Validate(schema, doc); err != nil {
+		t.Errorf("unexpected validation error with open objects: %s", err)
+	}
+
+}
+
+func TestValidate_Reference(t *testing.T) {
+
+	schema := MustParse(`type Address = {street: string; city: string}
+type Name = string
+{name: Name; home: Address; work: Address?}`)
+
+	cases := []struct {
+		TestData string
+		Error    *ValidationError
+	}{
+		{TestData: `{"name":"a","home":{"street":"b","city":"c"}}`},
+		{TestData: `{"name":"a","home":{"street":"b","city":"c"},"work":null}`},
+		{
+			TestData: `{"name":"a","home":{"street":"b","city":"c"},"work":{"street":"d"}}`,
+			Error:    &ValidationError{Path: "/work/city", Reason: MissingProperty, Expected: String, Offset: 66},
+		},
+		{
+			TestData: `{"name":1,"home":{"street":"b","city":"c"}}`,
+			Error:    &ValidationError{Path: "/name", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 9},
+		},
+		{
+			TestData: `{"name":"a"}`,
+			Error:    &ValidationError{Path: "/home", Reason: MissingProperty, Expected: Object, Offset: 12},
+		},
+	}
+
+	for i, c := range cases {
+
+		err := Validate(schema, []byte(c.TestData))
+		if c.Error == nil {
+			if err != nil {
+				t.Errorf("[case %d] unexpected validation error: %s", i, err)
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(err, c.Error) {
+			t.Errorf("[case %d] unexpected validation error: expected\n%s\nbut got\n%v", i, c.Error, err)
+		}
+
+	}
+
+}
+
+func TestValidate_Recursive(t *testing.T) {
+
+	schema := MustParse(`type Comment = {
+	text: string
+	replies: [Comment]?
+	parent: Comment?
+}
+{thread: [Comment]}`)
+
+	doc := []byte(`{"thread":[{"text":"a","replies":[{"text":"b","replies":[{"text":"c","parent":{"text":"b"}}]}]}]}`)
+	if err := Validate(schema, doc); err != nil {
+		t.Errorf("unexpected validation error: %s", err)
+	}
+
+	doc = []byte(`{"thread":[{"text":"a","replies":[{"text":"b","replies":[{"text":3}]}]}]}`)
+	expected := &ValidationError{Path: "/thread/0/replies/0/replies/0/text", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 66}
+	if err := Validate(schema, doc); !reflect.DeepEqual(err, expected) {
+		t.Errorf("unexpected validation error: expected\n%s\nbut got\n%v", expected, err)
+	}
+
+	// values nested too deeply are reported and skipped
+	opts := ValidatorOptions{MaxDepth: 4, AllErrors: true}
+	doc = []byte(`{"thread":[{"text":"a","replies":[{"text":"b","replies":[]}]},{"text":4}]}`)
+	err := opts.Validate(schema, doc)
+	expectedAll := ValidationErrors{
+		{Path: "/thread/0/replies/0", Reason: TooDeep, Expected: Object, Actual: "object", Detail: "object nested more than 4 deep", Offset: 35},
+		{Path: "/thread/1/text", Reason: TypeMismatch, Expected: String, Actual: "number", Offset: 71},
+	}
+	if !reflect.DeepEqual(err, expectedAll) {
+		t.Errorf("unexpected validation errors: expected\n%s\nbut got\n%v", expectedAll, err)
+	}
+
+	// the default limit stops a union that is its own alternative
+	schema = MustParse("type T = T | string\nT")
+	if err := Validate(schema, []byte(`"a"`)); err != nil {
+		t.Errorf("unexpected validation error: %s", err)
+	}
+	if err := Validate(schema, []byte(`1`)); err == nil {
+		t.Errorf("expected validation error")
+	}
+
+	// deeply nested documents don't exhaust the stack
+	deep := strings.Repeat(`{"text":"x","replies":[`, 5000) + strings.Repeat(`]}`, 5000)
+	if err, ok := Validate(MustParse("type C = {text: string; replies: [C]}\nC"), []byte(deep)).(*ValidationError); !ok || err.Reason != TooDeep {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+
+}
+
+func TestValidateReader(t *testing.T) {
+
+	schema := Type{Kind: Array, Items: &Type{Kind: Object, Properties: map[string]*Type{
+		"id": &Type{Kind: Number},
+	}}}
+
+	// stream a large document without ever holding it in memory
+	stream := func(n int, tail string) io.Reader {
+		pr, pw := io.Pipe()
+		go func() {
+			io.WriteString(pw, "[")
+			for i := 0; i < n; i++ {
+				if i > 0 {
+					io.WriteString(pw, ",")
+				}
+				fmt.Fprintf(pw, `{"id":%d}`, i)
+			}
+			io.WriteString(pw, "]"+tail)
+			pw.Close()
+		}()
+		return pr
+	}
+
+	if err := ValidateReader(schema, stream(10000, "")); err != nil {
+		t.Errorf("unexpected validation error: %s", err)
+	}
+
+	err := ValidateReader(schema, stream(2, ` {}`))
+	expected := &ValidationError{Reason: TrailingData, Expected: Array, Actual: "object", Offset: 21}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("unexpected validation error: expected %#v but got %#v", expected, err)
+	}
+
+}
+
+func TestValidatorOptions_Reporter(t *testing.T) {
+
+	schema := Type{Kind: Array, Items: &Type{Kind: Number}}
+
+	var reported []string
+	opts := ValidatorOptions{
+		Reporter: ReporterFunc(func(err *ValidationError) {
+			reported = append(reported, err.Path)
+		}),
+		AllErrors: true,
+	}
+
+	if err := opts.Validate(schema, []byte(`[1, "2", 3, true]`)); err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	if expected := []string{"/1", "/3"}; !reflect.DeepEqual(reported, expected) {
+		t.Errorf("unexpected reported paths: expected %v but got %v", expected, reported)
+	}
+
+}
+
+func TestValidationError(t *testing.T) {
+
+	cases := []struct {
+		Error   *ValidationError
+		Message string
+	}{
+		{
+			Error:   &ValidationError{Path: "/works/1/title", Reason: TypeMismatch, Expected: String, Actual: "number"},
+			Message: "jstn: /works/1/title: expected string but got number",
+		},
+		{
+			Error:   &ValidationError{Path: "/works/0/title", Reason: MissingProperty, Expected: String},
+			Message: "jstn: /works/0/title: missing required property of type string",
+		},
+		{
+			Error:   &ValidationError{Reason: TrailingData, Expected: Object, Actual: "boolean"},
+			Message: "jstn: unexpected boolean after top-level value",
+		},
+	}
+
+	for i, c := range cases {
+		if msg := c.Error.Error(); msg != c.Message {
+			t.Errorf("[case %d] unexpected message: expected %q but got %q", i, c.Message, msg)
+		}
+	}
+
+}
+
 func TestValidAPI(t *testing.T) {
 
 	schema := MustParse(`{